@@ -2,6 +2,9 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/thewebdevel/monkey-interpreter/token"
 )
@@ -133,6 +136,69 @@ func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+// FloatLiteral holds a floating point number, ex: 3.14 or 1e-9
+// Like the IntegerLiteral, the parser converts the literal of the token
+// to the float64 in Value
+type FloatLiteral struct {
+	Token token.Token // the token.FLOAT token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
+// StringLiteral holds a string, ex: "hello world"
+// Value is the value of the string with the escape sequences already
+// replaced by the lexer, so "a\tb" has a Value of a, tab, b
+type StringLiteral struct {
+	Token token.Token // the token.STRING token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// String puts the quotes back and escapes the value again, so the output
+// can be read back by the lexer
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+
+// quote returns value as a double quoted Monkey string literal.
+// Quotes, backslashes and non printable characters are escaped.
+func quote(value string) string {
+	var out bytes.Buffer
+
+	out.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if unicode.IsPrint(r) {
+				out.WriteRune(r)
+			} else {
+				fmt.Fprintf(&out, `\u{%X}`, r)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
 // PrefixExpression has two noteworthy fields, Operator and Right
 // Operator is a string that's going to contain either "-" or "!"
 // The Right field contains the expression to the right of the operator
@@ -152,7 +218,7 @@ func (pe *PrefixExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(pe.Operator)
-	out.WriteString(pe.Right.String())
+	out.WriteString(str(pe.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -177,21 +243,405 @@ func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(str(ie.Left))
 	out.WriteString(" " + ie.Operator + " ")
-	out.WriteString(ie.Right.String())
+	out.WriteString(str(ie.Right))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// Boolean holds true or false
+type Boolean struct {
+	Token token.Token // the token.TRUE or token.FALSE token
+	Value bool
+}
+
+func (b *Boolean) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+
+func (b *Boolean) String() string { return b.Token.Literal }
+
+// NullLiteral is the null keyword, the value that stands for no value
+type NullLiteral struct {
+	Token token.Token // the token.NULL token
+}
+
+func (n *NullLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (n *NullLiteral) TokenLiteral() string { return n.Token.Literal }
+
+func (n *NullLiteral) String() string { return n.Token.Literal }
+
+// BlockStatement is a series of statements enclosed in braces, like the
+// body of an if or a while. It works like a small Program
+type BlockStatement struct {
+	Token      token.Token // the { token
+	Statements []Statement
+}
+
+// statementNode satisfy the Statement Interface
+func (bs *BlockStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+
+func (bs *BlockStatement) String() string {
+	if bs == nil {
+		return ""
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for _, s := range bs.Statements {
+		out.WriteString(str(s))
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// IfExpression is an expression, it produces the value of the branch that
+// was taken: let max = if (x > y) { x } else { y };
+// Alternative is nil when there is no else
+type IfExpression struct {
+	Token       token.Token // the 'if' token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("if ")
+	out.WriteString(str(ie.Condition))
+	out.WriteString(" ")
+	out.WriteString(str(ie.Consequence))
+
+	if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+
+	return out.String()
+}
+
+// WhileStatement runs its Body for as long as the Condition holds
+// Ex: while (x < 10) { x += 1; }
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+// statementNode satisfy the Statement Interface
+func (ws *WhileStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while ")
+	out.WriteString(str(ws.Condition))
+	out.WriteString(" ")
+	out.WriteString(str(ws.Body))
+
+	return out.String()
+}
+
+// ForStatement is the C style loop: for (let i = 0; i < 10; i += 1) { ... }
+// Init, Condition and Post are all optional and nil when left out,
+// for (;;) { ... } loops until a break
+type ForStatement struct {
+	Token     token.Token // the 'for' token
+	Init      Statement   // a *LetStatement or an *ExpressionStatement
+	Condition Expression
+	Post      Expression
+	Body      *BlockStatement
+}
+
+// statementNode satisfy the Statement Interface
+func (fs *ForStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		// A let statement brings its own semicolon
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(str(fs.Body))
+
+	return out.String()
+}
+
+// BreakStatement leaves the innermost loop
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+// statementNode satisfy the Statement Interface
+func (bs *BreakStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+func (bs *BreakStatement) String() string { return bs.Token.Literal + ";" }
+
+// ContinueStatement skips to the next iteration of the innermost loop
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+// statementNode satisfy the Statement Interface
+func (cs *ContinueStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+func (cs *ContinueStatement) String() string { return cs.Token.Literal + ";" }
+
+// FunctionLiteral is fn, a list of parameters and a body:
+// fn(x, y) { return x + y; }
+// Functions are expressions, they can be bound with let, passed around and
+// called right where they are defined
+type FunctionLiteral struct {
+	Token      token.Token // the 'fn' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, str(p))
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(str(fl.Body))
+
+	return out.String()
+}
+
+// CallExpression calls Function with Arguments, ex: add(1, 2 * 3)
+// Function is any expression that produces a function, an identifier like
+// add or a function literal like fn(x) { x }(5)
+type CallExpression struct {
+	Token     token.Token // the '(' token
+	Function  Expression
+	Arguments []Expression
+}
+
+func (ce *CallExpression) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, str(a))
+	}
+
+	out.WriteString(str(ce.Function))
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
 
 	return out.String()
 }
 
+// ArrayLiteral is a list of expressions in brackets, ex: [1, 2 * 3, f(x)]
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, str(el))
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// IndexExpression picks a single element out of Left, ex: myArray[1 + 1]
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(str(ie.Left))
+	out.WriteString("[")
+	out.WriteString(str(ie.Index))
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// SliceExpression takes the elements from Low up to but not including High
+// out of Left, ex: myArray[1:3]. Both bounds are optional and nil when left
+// out, myArray[:2] starts at the first element and myArray[1:] goes to the end
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(str(se.Left))
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// HashLiteral is a map from keys to values, ex: {"one": 1, two(): 1 + 1}
+// Keys and values can be any expression. The pairs are kept in the order
+// they were written in
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Pairs []HashPair
+}
+
+// HashPair is a single key: value in a HashLiteral
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, str(pair.Key)+": "+str(pair.Value))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// BadStatement is put in place of a statement the parser couldn't make
+// sense of. The parser skipped the tokens from Token up to End, the rest of
+// the program is still there for tools that want to work with it
+type BadStatement struct {
+	Token token.Token    // the first token of the statement
+	End   token.Position // where the last skipped token ends
+}
+
+// statementNode satisfy the Statement Interface
+func (bs *BadStatement) statementNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+
+func (bs *BadStatement) String() string { return "<bad statement>" }
+
+// BadExpression is put in place of an expression that has an error, like
+// an integer literal that's too big or a token that can't start an expression
+type BadExpression struct {
+	Token token.Token    // the first token of the expression
+	End   token.Position // where the expression ends
+}
+
+func (be *BadExpression) expressionNode() {}
+
+// TokenLiteral satisfiy the Node Interface
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+
+func (be *BadExpression) String() string { return "<bad expression>" }
+
 // String method creates a buffer and writes the return value of each
 // statement's String() method to it. It then returns a buffer of a string.
 func (p *Program) String() string {
 	var out bytes.Buffer
 
 	for _, s := range p.Statements {
-		out.WriteString(s.String())
+		out.WriteString(str(s))
 	}
 
 	return out.String()
@@ -204,8 +654,8 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String() + " ")
-	out.WriteString("=")
+	out.WriteString(str(ls.Name) + " ")
+	out.WriteString("= ")
 
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -238,4 +688,20 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
-func (i *Identifier) String() string { return i.Value }
+func (i *Identifier) String() string {
+	if i == nil {
+		return ""
+	}
+	return i.Value
+}
+
+// str returns the String() of a node that may be missing. A parse error
+// can leave a node out of the tree, it's printed as nothing. The nodes held
+// in a pointer field, *Identifier and *BlockStatement, print a nil pointer
+// as nothing too
+func str(n Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
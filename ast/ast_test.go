@@ -1,6 +1,14 @@
 package ast
 
 import (
+	"encoding/json"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/thewebdevel/monkey-interpreter/token"
@@ -28,3 +36,679 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+// A parse error can leave parts of a node out, printing such a node must
+// still work
+func TestStringWithMissingNodes(t *testing.T) {
+	nodes := []Node{
+		&Program{Statements: []Statement{nil}},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{Statements: []Statement{nil}},
+		&WhileStatement{},
+		&ForStatement{},
+		&BreakStatement{},
+		&ContinueStatement{},
+		&BadStatement{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&StringLiteral{},
+		&Boolean{},
+		&NullLiteral{},
+		&PrefixExpression{Operator: "-"},
+		&InfixExpression{Operator: "+"},
+		&IfExpression{},
+		&FunctionLiteral{Parameters: []*Identifier{nil}},
+		&CallExpression{Arguments: []Expression{nil}},
+		&ArrayLiteral{Elements: []Expression{nil}},
+		&IndexExpression{},
+		&SliceExpression{},
+		&HashLiteral{Pairs: []HashPair{{}}},
+		&BadExpression{},
+	}
+
+	for _, node := range nodes {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%T.String() panicked: %v", node, r)
+				}
+			}()
+			_ = node.String()
+		}()
+	}
+}
+
+// Walk has to know every node type and every child of it. The test finds
+// the node types in the source of the package, so a new one that Walk
+// doesn't handle makes it fail. It fills every child of a node with a node
+// of its own and checks that Walk visits all of them
+func TestWalkCoversAllNodes(t *testing.T) {
+	nodes := allNodes()
+
+	var tested []string
+	for _, node := range nodes {
+		tested = append(tested, reflect.TypeOf(node).Elem().Name())
+	}
+	sort.Strings(tested)
+	declared := declaredNodeTypes(t)
+	if strings.Join(tested, " ") != strings.Join(declared, " ") {
+		t.Fatalf("the test doesn't know all node types.\ndeclared=%v\ntested=%v", declared, tested)
+	}
+
+	for _, node := range nodes {
+		children := fillChildren(t, reflect.ValueOf(node).Elem())
+
+		visited := map[Node]bool{}
+		opened, closed := 0, 0
+		Inspect(node, func(n Node) bool {
+			if n == nil {
+				closed++
+				return false
+			}
+			opened++
+			visited[n] = true
+			return true
+		})
+
+		if !visited[node] {
+			t.Errorf("%T: the node itself wasn't visited", node)
+		}
+		for _, child := range children {
+			if !visited[child] {
+				t.Errorf("%T: child %T wasn't visited", node, child)
+			}
+		}
+		if opened != closed {
+			t.Errorf("%T: %d nodes visited, but %d ended with nil", node, opened, closed)
+		}
+	}
+}
+
+// allNodes returns a new node of every type, without any children
+func allNodes() []Node {
+	return []Node{
+		&Program{},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&WhileStatement{},
+		&ForStatement{},
+		&BreakStatement{},
+		&ContinueStatement{},
+		&BadStatement{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&StringLiteral{},
+		&Boolean{},
+		&NullLiteral{},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&IfExpression{},
+		&FunctionLiteral{},
+		&CallExpression{},
+		&ArrayLiteral{},
+		&IndexExpression{},
+		&SliceExpression{},
+		&HashLiteral{},
+		&BadExpression{},
+	}
+}
+
+// declaredNodeTypes returns the sorted names of the types in the package
+// that have a TokenLiteral method, that's all the nodes
+func declaredNodeTypes(t *testing.T) []string {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	fset := gotoken.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := goparser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+			if star, ok := fn.Recv.List[0].Type.(*goast.StarExpr); ok {
+				names = append(names, star.X.(*goast.Ident).Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	expressionType = reflect.TypeOf((*Expression)(nil)).Elem()
+	statementType  = reflect.TypeOf((*Statement)(nil)).Elem()
+)
+
+// fillChildren puts a new node into every field of the struct v that can
+// hold one, and into a single element of every slice. It returns the nodes
+// it put in
+func fillChildren(t *testing.T, v reflect.Value) []Node {
+	var children []Node
+	for i := 0; i < v.NumField(); i++ {
+		children = append(children, fillValue(t, v.Field(i))...)
+	}
+	return children
+}
+
+func fillValue(t *testing.T, v reflect.Value) []Node {
+	var child Node
+	switch typ := v.Type(); {
+	case typ == expressionType:
+		child = &Identifier{Value: "x"}
+	case typ == statementType:
+		child = &BreakStatement{}
+	case typ.Kind() == reflect.Pointer && typ.Implements(nodeType):
+		child = reflect.New(typ.Elem()).Interface().(Node)
+	case typ.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(typ, 1, 1)
+		v.Set(s)
+		return fillValue(t, s.Index(0))
+	case typ.Kind() == reflect.Struct:
+		return fillChildren(t, v)
+	case typ.Kind() == reflect.Interface || typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Map:
+		t.Fatalf("the test doesn't know how to fill a %s", typ)
+	default:
+		return nil
+	}
+
+	v.Set(reflect.ValueOf(child))
+	return []Node{child}
+}
+
+func TestInspectOrder(t *testing.T) {
+	// if (a) { b[c]; } else { f(d, -e); }
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition: ident("a"),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &IndexExpression{Left: ident("b"), Index: ident("c")}},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &CallExpression{
+						Function:  ident("f"),
+						Arguments: []Expression{ident("d"), &PrefixExpression{Operator: "-", Right: ident("e")}},
+					}},
+				}},
+			}},
+		},
+	}
+
+	var names []string
+	Inspect(program, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		// Don't look into calls
+		_, isCall := n.(*CallExpression)
+		return !isCall
+	})
+
+	if got := strings.Join(names, " "); got != "a b c" {
+		t.Errorf("wrong identifiers. got=%q", got)
+	}
+
+	names = nil
+	Inspect(program, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+
+	if got := strings.Join(names, " "); got != "a b c f d e" {
+		t.Errorf("wrong identifiers. got=%q", got)
+	}
+}
+
+// Every child slot of every node type gets the replacement that's returned
+// for it, the node itself keeps its token
+func TestModifyCoversAllNodes(t *testing.T) {
+	for _, node := range allNodes() {
+		// Program is the only node without a token
+		pos := token.Position{Line: 3, Column: 7, Offset: 20}
+		tok := reflect.ValueOf(node).Elem().FieldByName("Token")
+		if tok.IsValid() {
+			tok.Set(reflect.ValueOf(token.Token{Start: pos}))
+		}
+		children := fillChildren(t, reflect.ValueOf(node).Elem())
+
+		isChild := map[Node]bool{}
+		for _, child := range children {
+			isChild[child] = true
+		}
+
+		// A child is replaced by a new node of the same type
+		replaced := map[Node]bool{}
+		result := Modify(node, func(n Node) Node {
+			if !isChild[n] {
+				return n
+			}
+			r := reflect.New(reflect.TypeOf(n).Elem()).Interface().(Node)
+			replaced[r] = true
+			return r
+		})
+
+		if result != node {
+			t.Errorf("%T: the node was replaced by %T", node, result)
+		}
+		if tok.IsValid() && tok.Interface().(token.Token).Start != pos {
+			t.Errorf("%T: the position changed. got=%s", node, tok.Interface().(token.Token).Start)
+		}
+
+		Inspect(node, func(n Node) bool {
+			if isChild[n] {
+				t.Errorf("%T: child %T wasn't replaced", node, n)
+			}
+			delete(replaced, n)
+			return true
+		})
+		if len(replaced) != 0 {
+			t.Errorf("%T: %d replacements didn't make it into the tree", node, len(replaced))
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2} }
+
+	// Turns every 1 into a 2
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return two()
+	}
+
+	tests := []struct {
+		input    Node
+		expected string
+	}{
+		{one(), "2"},
+		{&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}}, "2"},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, "(2 + 2)"},
+		{&InfixExpression{Left: two(), Operator: "+", Right: one()}, "(2 + 2)"},
+		{&PrefixExpression{Operator: "-", Right: one()}, "(-2)"},
+		{&IndexExpression{Left: one(), Index: one()}, "(2[2])"},
+		{&SliceExpression{Left: one(), Low: one()}, "(2[2:])"},
+		{&IfExpression{
+			Condition:   one(),
+			Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+		}, "if 2 {2} else {2}"},
+		{&ReturnStatement{Token: token.Token{Literal: "return"}, ReturnValue: one()}, "return 2;"},
+		{&LetStatement{Token: token.Token{Literal: "let"}, Name: &Identifier{Value: "x"}, Value: one()}, "let x = 2;"},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, "[2, 2]"},
+		{&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}}, "{2: 2}"},
+		{&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one()}}, "f(2)"},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if modified.String() != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, modified.String())
+		}
+	}
+}
+
+func TestModifyRemovesNodes(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: ident("a")},
+		&BreakStatement{Token: token.Token{Literal: "break"}},
+		&ExpressionStatement{Expression: &ArrayLiteral{Elements: []Expression{ident("b"), ident("c")}}},
+	}}
+
+	// Takes out the break and b
+	Modify(program, func(node Node) Node {
+		switch n := node.(type) {
+		case *BreakStatement:
+			return nil
+		case *Identifier:
+			if n.Value == "b" {
+				return nil
+			}
+		}
+		return node
+	})
+
+	if program.String() != "a[c]" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+}
+
+func TestModifyWrongReplacement(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r != "ast.Modify: *ast.BreakStatement can't replace the expression *ast.Identifier" {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "y"}}
+	Modify(let, func(node Node) Node {
+		if n, ok := node.(*Identifier); ok && n.Value == "y" {
+			return &BreakStatement{}
+		}
+		return node
+	})
+}
+
+// Every node type with all its children comes back from its JSON the way
+// it was
+func TestJSONCoversAllNodes(t *testing.T) {
+	var kinds []string
+	for kind := range nodeKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	declared := declaredNodeTypes(t)
+	if strings.Join(kinds, " ") != strings.Join(declared, " ") {
+		t.Fatalf("the JSON doesn't know all node types.\ndeclared=%v\nknown=%v", declared, kinds)
+	}
+
+	for _, node := range allNodes() {
+		fillChildren(t, reflect.ValueOf(node).Elem())
+
+		data, err := MarshalJSON(node)
+		if err != nil {
+			t.Fatalf("%T: %v", node, err)
+		}
+		decoded, err := UnmarshalJSON(data)
+		if err != nil {
+			t.Fatalf("%T: %v\n%s", node, err, data)
+		}
+		if !reflect.DeepEqual(node, decoded) {
+			t.Errorf("%T: the tree changed.\n%s", node, data)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	pos := func(offset int) token.Position {
+		return token.Position{Filename: "a.mk", Offset: offset, Line: 1, Column: offset + 1}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Start: pos(0), End: pos(3)},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Start: pos(4), End: pos(5)},
+					Value: "x",
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"kind":"Program","statements":[{"kind":"LetStatement",` +
+		`"token":{"type":"LET","literal":"let",` +
+		`"start":{"filename":"a.mk","offset":0,"line":1,"column":1},` +
+		`"end":{"filename":"a.mk","offset":3,"line":1,"column":4}},` +
+		`"name":{"kind":"Identifier","token":{"type":"IDENT","literal":"x",` +
+		`"start":{"filename":"a.mk","offset":4,"line":1,"column":5},` +
+		`"end":{"filename":"a.mk","offset":5,"line":1,"column":6}},"value":"x"},` +
+		`"value":null}]}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot= %s", expected, data)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(program, &decoded) {
+		t.Errorf("the program changed. got=%q", decoded.String())
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nothing"}`, `ast: unknown node kind "Nothing"`},
+		{`{"value":"x"}`, `ast: a node needs a kind`},
+		{`{"kind":"LetStatement","value":{"kind":"BreakStatement"}}`,
+			`ast: LetStatement.value: got a BreakStatement for a field of type Expression`},
+		{`{"kind":"ExpressionStatement","token":{"type":"NOPE"}}`,
+			`ast: ExpressionStatement.token: token: unknown token type "NOPE"`},
+		{`[1]`, `ast: a node has to be an object, got array`},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s.\nwant=%s\ngot= %v", tt.input, tt.expected, err)
+		}
+	}
+
+	var program Program
+	err := json.Unmarshal([]byte(`{"kind":"Identifier"}`), &program)
+	if err == nil || err.Error() != "ast: expected a Program, got Identifier" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	// A null is no Program, but it's not an error either
+	program = Program{Statements: []Statement{&BreakStatement{}}}
+	if err := program.UnmarshalJSON([]byte("null")); err != nil {
+		t.Errorf("null returned an error: %v", err)
+	}
+	if err := json.Unmarshal([]byte("null"), &program); err != nil {
+		t.Errorf("null returned an error: %v", err)
+	}
+	if len(program.Statements) != 1 {
+		t.Errorf("null changed the program. got=%d statements", len(program.Statements))
+	}
+}
+
+func TestSExprAndDot(t *testing.T) {
+	// let f = fn(x) { x[1:] }; f("a\n", -2.5);
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("x")},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &SliceExpression{
+							Left: ident("x"),
+							Low:  &IntegerLiteral{Token: token.Token{Literal: "1"}, Value: 1},
+						}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: ident("f"),
+				Arguments: []Expression{
+					&StringLiteral{Value: "a\n"},
+					&PrefixExpression{Operator: "-", Right: &FloatLiteral{Token: token.Token{Literal: "2.5"}, Value: 2.5}},
+				},
+			}},
+		},
+	}
+
+	expected := `(Program
+  (LetStatement
+    (Identifier f)
+    (FunctionLiteral
+      (Identifier x)
+      (BlockStatement
+        (ExpressionStatement
+          (SliceExpression
+            (Identifier x)
+            (IntegerLiteral 1)
+            nil)))))
+  (ExpressionStatement
+    (CallExpression
+      (Identifier f)
+      (StringLiteral "a\n")
+      (PrefixExpression -
+        (FloatLiteral 2.5)))))`
+	if got := SExpr(program); got != expected {
+		t.Errorf("wrong S-expression.\nwant=%s\ngot= %s", expected, got)
+	}
+
+	expected = `digraph AST {
+	node [shape=box, fontname=monospace];
+	edge [fontname=monospace, fontsize=10];
+	n0 [label="ExpressionStatement"];
+	n1 [label="CallExpression"];
+	n2 [label="Identifier f"];
+	n1 -> n2 [label="function"];
+	n3 [label="StringLiteral \"a\\n\""];
+	n1 -> n3 [label="arguments[0]"];
+	n4 [label="PrefixExpression -"];
+	n5 [label="FloatLiteral 2.5"];
+	n4 -> n5 [label="right"];
+	n1 -> n4 [label="arguments[1]"];
+	n0 -> n1 [label="expression"];
+}
+`
+	if got := Dot(program.Statements[1]); got != expected {
+		t.Errorf("wrong graph.\nwant=%s\ngot= %s", expected, got)
+	}
+
+	if got := SExpr(nil); got != "nil" {
+		t.Errorf("wrong S-expression for nil. got=%q", got)
+	}
+}
+
+// SExpr and Dot show every child of every node type
+func TestSExprAndDotCoverAllNodes(t *testing.T) {
+	for _, node := range allNodes() {
+		children := fillChildren(t, reflect.ValueOf(node).Elem())
+
+		sexpr := SExpr(node)
+		dot := Dot(node)
+		kind := reflect.TypeOf(node).Elem().Name()
+		if !strings.HasPrefix(sexpr, "("+kind) || !strings.Contains(dot, `"`+kind) {
+			t.Errorf("%s is missing.\n%s\n%s", kind, sexpr, dot)
+		}
+		if n := strings.Count(dot, "->"); n != len(children) {
+			t.Errorf("%s: wrong number of edges. expected=%d, got=%d\n%s", kind, len(children), n, dot)
+		}
+		if n := strings.Count(sexpr, "\n"); n != len(children) {
+			t.Errorf("%s: wrong number of children. expected=%d, got=%d\n%s", kind, len(children), n, sexpr)
+		}
+	}
+}
+
+func TestEqualAndDiff(t *testing.T) {
+	// let x = 1 + 2;, with the 1 at the given column
+	program := func(column int, right Expression) *Program {
+		one := token.Token{Type: token.INT, Literal: "1", Start: token.Position{Line: 1, Column: column}}
+		return &Program{Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+				Value: &InfixExpression{
+					Token:    token.Token{Type: token.PLUS, Literal: "+"},
+					Left:     &IntegerLiteral{Token: one, Value: 1},
+					Operator: "+",
+					Right:    right,
+				},
+			},
+		}}
+	}
+	two := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	three := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 3}
+
+	tests := []struct {
+		a, b     Node
+		opts     []EqualOption
+		expected string
+	}{
+		{program(9, two), program(9, two), nil, ""},
+		{nil, nil, nil, ""},
+		{
+			program(9, two), program(10, two), nil,
+			"Program.statements[0].value.left.token.start: 1:9 != 1:10",
+		},
+		{program(9, two), program(10, two), []EqualOption{IgnorePositions()}, ""},
+		{
+			program(9, two), program(9, three), []EqualOption{IgnorePositions()},
+			"Program.statements[0].value.right.value: 2 != 3",
+		},
+		{
+			program(9, two), program(9, &Identifier{Value: "y"}), nil,
+			"Program.statements[0].value.right: IntegerLiteral 2 != Identifier y",
+		},
+		{
+			program(9, two), program(9, nil), nil,
+			"Program.statements[0].value.right: IntegerLiteral 2 != nil",
+		},
+		{
+			program(9, two), &Program{}, nil,
+			"Program.statements: length 1 != 0",
+		},
+		{
+			&Identifier{Value: "a b"}, &Identifier{Value: "ab"}, nil,
+			`Identifier.value: "a b" != "ab"`,
+		},
+		{two, nil, nil, "IntegerLiteral: IntegerLiteral 2 != nil"},
+		{
+			&Identifier{Token: token.Token{LeadingTrivia: []token.Trivia{{Kind: token.LINE_COMMENT, Text: "// x"}}}},
+			&Identifier{}, []EqualOption{IgnoreTrivia()}, "",
+		},
+	}
+
+	for _, tt := range tests {
+		got := Diff(tt.a, tt.b, tt.opts...)
+		if got != tt.expected {
+			t.Errorf("wrong diff.\nwant=%q\ngot= %q", tt.expected, got)
+		}
+		if Equal(tt.a, tt.b, tt.opts...) != (tt.expected == "") {
+			t.Errorf("Equal doesn't agree with Diff %q", got)
+		}
+	}
+}
+
+// Equal looks at every child of every node type
+func TestEqualCoversAllNodes(t *testing.T) {
+	for _, node := range allNodes() {
+		kind := reflect.TypeOf(node).Elem().Name()
+		other := reflect.New(reflect.TypeOf(node).Elem())
+		fillChildren(t, reflect.ValueOf(node).Elem())
+		children := fillChildren(t, other.Elem())
+
+		if d := Diff(node, other.Interface().(Node)); d != "" {
+			t.Fatalf("%s: the same trees differ: %s", kind, d)
+		}
+		for _, child := range children {
+			literal := reflect.ValueOf(child).Elem().FieldByName("Token").FieldByName("Literal")
+			literal.SetString("changed")
+			d := Diff(node, other.Interface().(Node))
+			if !strings.HasSuffix(d, `.token.literal: "" != "changed"`) {
+				t.Errorf("%s: a changed %T isn't found. got=%q", kind, child, d)
+			}
+			literal.SetString("")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// String prints a tree as code, with parentheses around every operation.
+// SExpr and Dot print the tree itself, which makes it easier to see how
+// the parser put it together. For 1 + 2 * 3 SExpr gives:
+//
+//	(Program
+//	  (ExpressionStatement
+//	    (InfixExpression +
+//	      (IntegerLiteral 1)
+//	      (InfixExpression *
+//	        (IntegerLiteral 2)
+//	        (IntegerLiteral 3)))))
+//
+// and Dot gives a graph for Graphviz: monkey ast --dot main.mk | dot -Tsvg
+
+// SExpr returns the tree below node as an indented S-expression. Every node
+// is a list with its kind, its operator or value and its children. A child
+// that's missing, like the else of an if without one, is written as nil
+func SExpr(node Node) string {
+	var out bytes.Buffer
+	writeSExpr(&out, node, 0)
+	return out.String()
+}
+
+func writeSExpr(out *bytes.Buffer, node Node, indent int) {
+	if isNil(node) {
+		out.WriteString("nil")
+		return
+	}
+
+	out.WriteString("(" + label(node))
+	for _, child := range children(node) {
+		out.WriteString("\n" + strings.Repeat("  ", indent+1))
+		writeSExpr(out, child.node, indent+1)
+	}
+	out.WriteString(")")
+}
+
+// Dot returns the tree below node as a graph in the DOT language of
+// Graphviz. The edges are labeled with the fields of the nodes, the missing
+// children are left out
+func Dot(node Node) string {
+	var out bytes.Buffer
+	out.WriteString("digraph AST {\n")
+	out.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	out.WriteString("\tedge [fontname=monospace, fontsize=10];\n")
+
+	id := 0
+	var write func(node Node) int
+	write = func(node Node) int {
+		n := id
+		id++
+		fmt.Fprintf(&out, "\tn%d [label=%s];\n", n, dotQuote(label(node)))
+		for _, child := range children(node) {
+			if isNil(child.node) {
+				continue
+			}
+			c := write(child.node)
+			fmt.Fprintf(&out, "\tn%d -> n%d [label=%s];\n", n, c, dotQuote(child.name))
+		}
+		return n
+	}
+	if !isNil(node) {
+		write(node)
+	}
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// label is the kind of a node, followed by what sets it apart from other
+// nodes of its kind, ex: InfixExpression + or Identifier x
+func label(node Node) string {
+	kind := kindOf(node)
+	switch n := node.(type) {
+	case *Identifier:
+		return kind + " " + n.Value
+	case *IntegerLiteral, *FloatLiteral, *Boolean:
+		return kind + " " + n.TokenLiteral()
+	case *StringLiteral:
+		return kind + " " + quote(n.Value)
+	case *PrefixExpression:
+		return kind + " " + n.Operator
+	case *InfixExpression:
+		return kind + " " + n.Operator
+	}
+	return kind
+}
+
+type child struct {
+	name string // the field, ex: left or arguments[1]
+	node Node
+}
+
+// children returns the child slots of node in the order of the fields of
+// its type, which is the order they have in the source. An element of a
+// list is a slot of its own
+func children(node Node) []child {
+	var list []child
+	var add func(name string, v reflect.Value)
+	add = func(name string, v reflect.Value) {
+		switch {
+		case v.Type().Implements(nodeType):
+			var n Node
+			if !v.IsNil() {
+				n = v.Interface().(Node)
+			}
+			list = append(list, child{name, n})
+		case v.Kind() == reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				add(name+"["+strconv.Itoa(i)+"]", v.Index(i))
+			}
+		case v.Kind() == reflect.Struct && v.Type().PkgPath() == astPath:
+			for i := 0; i < v.NumField(); i++ {
+				add(name+"."+fieldName(v.Type().Field(i)), v.Field(i))
+			}
+		}
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		add(fieldName(v.Type().Field(i)), v.Field(i))
+	}
+	return list
+}
+
+// isNil reports whether node is missing, also when it's a nil pointer of
+// a node type
+func isNil(node Node) bool {
+	return node == nil || reflect.ValueOf(node).IsNil()
+}
+
+// dotQuote makes s a string in the DOT language
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,142 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+// Comparing the String() of two trees leaves out the tokens, and when the
+// strings differ it doesn't tell where. Equal compares every field of every
+// node, the tokens included. Diff tells where two trees differ, as the path
+// from the top to the first field that isn't the same:
+//
+//	Program.statements[0].value.right.value: 3 != 4
+//
+// Two trees parsed from different sources never have the same positions,
+// IgnorePositions leaves them out
+
+// EqualOption changes what Equal and Diff compare
+type EqualOption func(*equalConfig)
+
+type equalConfig struct {
+	ignorePositions bool
+	ignoreTrivia    bool
+}
+
+// IgnorePositions leaves the positions of the tokens out, the ones of
+// their trivia included
+func IgnorePositions() EqualOption {
+	return func(c *equalConfig) { c.ignorePositions = true }
+}
+
+// IgnoreTrivia leaves out the whitespace and the comments around the
+// tokens, a tree parsed without lexer.WithTrivia has none of them
+func IgnoreTrivia() EqualOption {
+	return func(c *equalConfig) { c.ignoreTrivia = true }
+}
+
+// Equal reports whether the trees below a and b are the same
+func Equal(a, b Node, opts ...EqualOption) bool {
+	return Diff(a, b, opts...) == ""
+}
+
+// Diff returns where the trees below a and b differ first, and how, or
+// an empty string when they are the same
+func Diff(a, b Node, opts ...EqualOption) string {
+	c := &equalConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	path := "node"
+	if !isNil(a) {
+		path = kindOf(a)
+	} else if !isNil(b) {
+		path = kindOf(b)
+	}
+
+	// Both are looked at as Nodes, even when their types differ
+	return c.diff(path, reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem())
+}
+
+var (
+	positionType = reflect.TypeOf(token.Position{})
+	triviaType   = reflect.TypeOf([]token.Trivia(nil))
+)
+
+// diff compares a and b, which have the same type
+func (c *equalConfig) diff(path string, a, b reflect.Value) string {
+	switch {
+	case c.ignorePositions && a.Type() == positionType,
+		c.ignoreTrivia && a.Type() == triviaType:
+		return ""
+
+	case a.Type().Implements(nodeType):
+		nodeA, _ := a.Interface().(Node)
+		nodeB, _ := b.Interface().(Node)
+		if isNil(nodeA) || isNil(nodeB) {
+			if isNil(nodeA) && isNil(nodeB) {
+				return ""
+			}
+			return fmt.Sprintf("%s: %s != %s", path, describeNode(nodeA), describeNode(nodeB))
+		}
+		va, vb := reflect.ValueOf(nodeA).Elem(), reflect.ValueOf(nodeB).Elem()
+		if va.Type() != vb.Type() {
+			return fmt.Sprintf("%s: %s != %s", path, describeNode(nodeA), describeNode(nodeB))
+		}
+		return c.fields(path, va, vb)
+
+	case a.Kind() == reflect.Slice:
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			if d := c.diff(path+"["+strconv.Itoa(i)+"]", a.Index(i), b.Index(i)); d != "" {
+				return d
+			}
+		}
+		if a.Len() != b.Len() {
+			return fmt.Sprintf("%s: length %d != %d", path, a.Len(), b.Len())
+		}
+		return ""
+
+	case a.Kind() == reflect.Struct && a.Type() != positionType:
+		return c.fields(path, a, b)
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return fmt.Sprintf("%s: %s != %s", path, describeValue(a), describeValue(b))
+	}
+	return ""
+}
+
+// fields compares the fields of the structs a and b one after the other
+func (c *equalConfig) fields(path string, a, b reflect.Value) string {
+	for i := 0; i < a.NumField(); i++ {
+		name := path + "." + fieldName(a.Type().Field(i))
+		if d := c.diff(name, a.Field(i), b.Field(i)); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// describeNode is a node in a Diff, ex: InfixExpression + or nil
+func describeNode(node Node) string {
+	if isNil(node) {
+		return "nil"
+	}
+	return label(node)
+}
+
+// describeValue is a field that isn't a node in a Diff. Strings are quoted
+// so that a missing space shows
+func describeValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case string:
+		return strconv.Quote(x)
+	case fmt.Stringer:
+		return x.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
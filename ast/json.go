@@ -0,0 +1,277 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A tree can be written as JSON, for tools that aren't written in Go. Every
+// node is an object with its kind, the name of its type, and its fields.
+// The names of the fields start with a lower case letter and a child that's
+// missing is null:
+//
+//	{"kind": "LetStatement",
+//	 "token": {"type": "LET", "literal": "let", "start": {...}, "end": {...}},
+//	 "name": {"kind": "Identifier", "token": {...}, "value": "x"},
+//	 "value": {"kind": "IntegerLiteral", "token": {...}, "value": 5}}
+//
+// Tokens are the JSON of token.Token, their type is written as its name, so
+// a custom type made with token.Register has to be registered again before
+// such a tree is read back. Positions have a filename, an offset, a line and
+// a column. A HashPair is an object with a key and a value and no kind.
+//
+// Nothing is left out, reading the JSON back gives the same tree
+
+// nodeKinds maps the kind of every node to its type
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &LetStatement{}, &ReturnStatement{}, &ExpressionStatement{},
+		&BlockStatement{}, &WhileStatement{}, &ForStatement{}, &BreakStatement{},
+		&ContinueStatement{}, &BadStatement{},
+		&Identifier{}, &IntegerLiteral{}, &FloatLiteral{}, &StringLiteral{},
+		&Boolean{}, &NullLiteral{}, &PrefixExpression{}, &InfixExpression{},
+		&IfExpression{}, &FunctionLiteral{}, &CallExpression{}, &ArrayLiteral{},
+		&IndexExpression{}, &SliceExpression{}, &HashLiteral{}, &BadExpression{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+	astPath  = nodeType.PkgPath()
+)
+
+// MarshalJSON returns the JSON of the tree below node
+func MarshalJSON(node Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeNode(&buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads a tree back from the JSON written by MarshalJSON
+func UnmarshalJSON(data []byte) (Node, error) {
+	node, err := decodeNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("ast: %w", err)
+	}
+	return node, nil
+}
+
+// MarshalJSON makes a Program work with json.Marshal
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(p)
+}
+
+// UnmarshalJSON makes a Program work with json.Unmarshal. Like the types
+// of encoding/json, a null leaves the Program alone
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := UnmarshalJSON(data)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return nil
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: expected a Program, got %s", kindOf(node))
+	}
+	*p = *program
+	return nil
+}
+
+func encodeNode(buf *bytes.Buffer, node Node) error {
+	v := reflect.ValueOf(node)
+	if node == nil || v.IsNil() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	typ := v.Elem().Type()
+	if nodeKinds[typ.Name()] != typ {
+		return fmt.Errorf("ast: can't encode a %T", node)
+	}
+
+	buf.WriteString(`{"kind":"` + typ.Name() + `"`)
+	if err := encodeFields(buf, v.Elem(), false); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeFields writes the fields of the struct v, first tells whether
+// there's nothing in the object yet
+func encodeFields(buf *bytes.Buffer, v reflect.Value, first bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(`"` + fieldName(v.Type().Field(i)) + `":`)
+		if err := encodeValue(buf, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case v.Type().Implements(nodeType):
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeNode(buf, v.Interface().(Node))
+
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	case v.Kind() == reflect.Struct && v.Type().PkgPath() == astPath:
+		buf.WriteByte('{')
+		if err := encodeFields(buf, v, true); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+
+	// Tokens, strings and numbers
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+func decodeNode(data []byte) (Node, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("a node has to be an object, got %s", typeErr.Value)
+		}
+		return nil, err
+	}
+	if fields == nil {
+		return nil, nil
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return nil, fmt.Errorf("a node needs a kind")
+	}
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	v := reflect.New(typ)
+	if err := decodeFields(v.Elem(), fields); err != nil {
+		return nil, fmt.Errorf("%s.%w", kind, err)
+	}
+	return v.Interface().(Node), nil
+}
+
+// decodeFields fills the fields of the struct v. The fields that aren't
+// in the JSON are left alone
+func decodeFields(v reflect.Value, fields map[string]json.RawMessage) error {
+	for i := 0; i < v.NumField(); i++ {
+		name := fieldName(v.Type().Field(i))
+		data, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(v.Field(i), data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func decodeValue(v reflect.Value, data []byte) error {
+	switch {
+	case v.Type().Implements(nodeType):
+		node, err := decodeNode(data)
+		if err != nil || node == nil {
+			return err
+		}
+		if !reflect.TypeOf(node).AssignableTo(v.Type()) {
+			return fmt.Errorf("got a %s for a field of type %s", kindOf(node), typeName(v.Type()))
+		}
+		v.Set(reflect.ValueOf(node))
+		return nil
+
+	case v.Kind() == reflect.Slice:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return err
+		}
+		if elements == nil {
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), len(elements), len(elements))
+		for i, element := range elements {
+			if err := decodeValue(s.Index(i), element); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case v.Kind() == reflect.Struct && v.Type().PkgPath() == astPath:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return decodeFields(v, fields)
+	}
+
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// fieldName is the name of a field in the JSON, ex: returnValue for
+// ReturnValue
+func fieldName(field reflect.StructField) string {
+	r, size := utf8.DecodeRuneInString(field.Name)
+	return string(unicode.ToLower(r)) + field.Name[size:]
+}
+
+// kindOf is the kind of node for an error message
+func kindOf(node Node) string {
+	return typeName(reflect.TypeOf(node))
+}
+
+func typeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
@@ -0,0 +1,198 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc is called by Modify for every node of a tree and returns the
+// node to put in its place. Returning the node it got leaves it alone
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree below node. It works from the bottom up: the
+// children of a node are modified first, every child slot of the node gets
+// the node that came back for it and then the node itself is handed to
+// modifier. The result of that is returned. This is what we need to turn
+// one piece of code into another, for example to fold constants:
+//
+//	ast.Modify(program, func(n ast.Node) ast.Node {
+//		infix, ok := n.(*ast.InfixExpression)
+//		if !ok || infix.Operator != "+" {
+//			return n
+//		}
+//		left, ok1 := infix.Left.(*ast.IntegerLiteral)
+//		right, ok2 := infix.Right.(*ast.IntegerLiteral)
+//		if !ok1 || !ok2 {
+//			return n
+//		}
+//		return &ast.IntegerLiteral{Token: left.Token, Value: left.Value + right.Value}
+//	})
+//
+// The nodes are changed in place, nothing is copied. A node that isn't
+// replaced keeps its tokens and with them its position in the source. A
+// replacement must fit into its slot, an Expression where an expression
+// goes, or Modify panics. Returning nil empties the slot, in a list like
+// Program.Statements the element is taken out
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	// Statements
+	case *Program:
+		n.Statements = modifyStatements(n.Statements, modifier)
+
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+
+	case *BlockStatement:
+		n.Statements = modifyStatements(n.Statements, modifier)
+
+	case *WhileStatement:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *ForStatement:
+		n.Init = modifyStatement(n.Init, modifier)
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Post = modifyExpression(n.Post, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *BreakStatement, *ContinueStatement, *BadStatement:
+		// no children
+
+	// Expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral,
+		*Boolean, *NullLiteral, *BadExpression:
+		// no children
+
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+
+	case *FunctionLiteral:
+		params := n.Parameters[:0]
+		for _, p := range n.Parameters {
+			if p = modifyIdentifier(p, modifier); p != nil {
+				params = append(params, p)
+			}
+		}
+		n.Parameters = params
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		n.Arguments = modifyExpressions(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		n.Elements = modifyExpressions(n.Elements, modifier)
+
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+
+	case *SliceExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Low = modifyExpression(n.Low, modifier)
+		n.High = modifyExpression(n.High, modifier)
+
+	case *HashLiteral:
+		for i := range n.Pairs {
+			n.Pairs[i].Key = modifyExpression(n.Pairs[i].Key, modifier)
+			n.Pairs[i].Value = modifyExpression(n.Pairs[i].Value, modifier)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) []Statement {
+	result := list[:0]
+	for _, s := range list {
+		if s = modifyStatement(s, modifier); s != nil {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) []Expression {
+	result := list[:0]
+	for _, e := range list {
+		if e = modifyExpression(e, modifier); e != nil {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// The functions below modify the node in a slot of a certain type. A slot
+// that's empty stays empty, modifier isn't called for it
+
+func modifyStatement(s Statement, modifier ModifierFunc) Statement {
+	if s == nil {
+		return nil
+	}
+	switch r := Modify(s, modifier).(type) {
+	case nil:
+		return nil
+	case Statement:
+		return r
+	default:
+		panic(fmt.Sprintf("ast.Modify: %T can't replace the statement %T", r, s))
+	}
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	switch r := Modify(e, modifier).(type) {
+	case nil:
+		return nil
+	case Expression:
+		return r
+	default:
+		panic(fmt.Sprintf("ast.Modify: %T can't replace the expression %T", r, e))
+	}
+}
+
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+	switch r := Modify(i, modifier).(type) {
+	case nil:
+		return nil
+	case *Identifier:
+		return r
+	default:
+		panic(fmt.Sprintf("ast.Modify: %T can't replace the identifier %s", r, i.Value))
+	}
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	switch r := Modify(b, modifier).(type) {
+	case nil:
+		return nil
+	case *BlockStatement:
+		return r
+	default:
+		panic(fmt.Sprintf("ast.Modify: %T can't replace a block", r))
+	}
+}
@@ -0,0 +1,164 @@
+package ast
+
+import "fmt"
+
+// Walk and Inspect go through a tree in depth first order, the same way
+// go/ast does it for Go code. Tools that look at a program, like a linter or
+// something that collects all the identifiers, use them instead of a type
+// switch over every node of their own:
+//
+//	ast.Inspect(program, func(n ast.Node) bool {
+//		if ident, ok := n.(*ast.Identifier); ok {
+//			names = append(names, ident.Value)
+//		}
+//		return true
+//	})
+//
+// The parts of a node that a parse error left out are nil, they are skipped
+
+// Visitor has its Visit method called for every node Walk comes across. If
+// Visit returns a Visitor w, the children of node are walked with w and
+// then w.Visit(nil) is called. If it returns nil, the children are skipped
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk calls v.Visit(node) and then walks the children of node, in the
+// order they appear in the source. node must not be nil
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Statements
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkExpression(v, n.Value)
+
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *WhileStatement:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Body)
+
+	case *ForStatement:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		walkExpression(v, n.Condition)
+		walkExpression(v, n.Post)
+		walkBlock(v, n.Body)
+
+	case *BreakStatement, *ContinueStatement, *BadStatement:
+		// no children
+
+	// Expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral,
+		*Boolean, *NullLiteral, *BadExpression:
+		// no children
+
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			if p != nil {
+				Walk(v, p)
+			}
+		}
+		walkBlock(v, n.Body)
+
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+
+	case *SliceExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Low)
+		walkExpression(v, n.High)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkExpression(v, pair.Key)
+			walkExpression(v, pair.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walkExpression(v, e)
+	}
+}
+
+func walkExpression(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+// walkBlock is there because a nil *BlockStatement doesn't compare equal to
+// nil once it's in a Node
+func walkBlock(v Visitor, b *BlockStatement) {
+	if b != nil {
+		Walk(v, b)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect walks the tree below node and calls f for every node, like Walk
+// does. If f returns true, Inspect goes on to the children of node and then
+// calls f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
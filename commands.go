@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/format"
+	"github.com/thewebdevel/monkey-interpreter/lexer"
+	"github.com/thewebdevel/monkey-interpreter/parser"
+)
+
+// A command gets the arguments after its name and returns the exit code
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+// commands are what monkey can do besides starting the REPL
+var commands = map[string]command{
+	"ast": {astCommand, "ast [--json|--sexpr|--dot] [file]    print the syntax tree of a program"},
+	"fmt": {fmtCommand, "fmt [-w|-l|-d] [files]              format programs in the canonical form"},
+}
+
+// run runs the command name and returns its exit code
+func run(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n", name)
+		printUsage()
+		return 2
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: monkey [command]")
+	fmt.Fprintln(os.Stderr, "without a command monkey starts the REPL, the commands are:")
+	for _, name := range []string{"ast", "fmt"} {
+		fmt.Fprintln(os.Stderr, "  monkey "+commands[name].usage)
+	}
+}
+
+// astCommand parses a program and prints its tree. The tree is printed
+// even when the program has errors, the broken parts show up as bad
+// statements and expressions. Without a flag it's printed as code, with
+// String()
+func astCommand(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the tree as JSON, with all tokens and positions")
+	asSExpr := flags.Bool("sexpr", false, "print the tree as an indented S-expression")
+	asDot := flags.Bool("dot", false, "print the tree as a Graphviz graph")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if count(*asJSON, *asSExpr, *asDot) > 1 {
+		fmt.Fprintln(os.Stderr, "monkey: --json, --sexpr and --dot can't be used together")
+		return 2
+	}
+
+	filename, src, err := readSource(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "monkey:", err)
+		return 1
+	}
+
+	// The JSON is lossless, so it keeps the comments too
+	opts := []lexer.Option{lexer.WithFilename(filename)}
+	if *asJSON {
+		opts = append(opts, lexer.WithTrivia())
+	}
+	p := parser.New(lexer.New(src, opts...))
+	program := p.ParseProgram()
+
+	switch {
+	case *asJSON:
+		err = writeJSON(os.Stdout, program)
+	case *asSExpr:
+		_, err = fmt.Fprintln(os.Stdout, ast.SExpr(program))
+	case *asDot:
+		_, err = fmt.Fprint(os.Stdout, ast.Dot(program))
+	default:
+		_, err = fmt.Fprintln(os.Stdout, program.String())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "monkey:", err)
+		return 1
+	}
+
+	return reportErrors(p.Errors())
+}
+
+// fmtCommand formats programs. Without files it formats the standard input
+// and prints the result, a file is printed too unless one of the flags
+// says otherwise
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result back to the files instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	showDiff := flags.Bool("d", false, "print the changes as a diff instead of the result")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "monkey: -w needs files to write to")
+			return 2
+		}
+		files = []string{"-"}
+	}
+
+	code := 0
+	for _, name := range files {
+		if err := formatFile(name, *write, *list, *showDiff); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// formatFile formats the file name, - is the standard input
+func formatFile(name string, write, list, showDiff bool) error {
+	var src []byte
+	var err error
+	if name == "-" {
+		src, err = io.ReadAll(os.Stdin)
+		name = "<stdin>"
+	} else {
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return fmt.Errorf("monkey: %w", err)
+	}
+
+	// The parse errors already have the file in their position
+	filename := name
+	if filename == "<stdin>" {
+		filename = ""
+	}
+	res, err := format.Source(filename, src)
+	if err != nil {
+		return err
+	}
+
+	changed := !bytes.Equal(src, res)
+	if list && changed {
+		fmt.Fprintln(os.Stdout, name)
+	}
+	if showDiff {
+		os.Stdout.Write(diff(name, src, res))
+	}
+	if write && changed {
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("monkey: %w", err)
+		}
+		if err := os.WriteFile(name, res, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("monkey: %w", err)
+		}
+	}
+	if !write && !list && !showDiff {
+		os.Stdout.Write(res)
+	}
+	return nil
+}
+
+// count returns how many of flags are set
+func count(flags ...bool) int {
+	n := 0
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
+
+// readSource reads the file named in args, or the standard input when
+// there is none or it's -
+func readSource(args []string) (filename, src string, err error) {
+	switch {
+	case len(args) > 1:
+		return "", "", fmt.Errorf("too many files, expected one")
+	case len(args) == 0 || args[0] == "-":
+		data, err := io.ReadAll(os.Stdin)
+		return "", string(data), err
+	}
+
+	data, err := os.ReadFile(args[0])
+	return args[0], string(data), err
+}
+
+func writeJSON(w io.Writer, node ast.Node) error {
+	data, err := ast.MarshalJSON(node)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(json.RawMessage(data), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// reportErrors prints the parse errors and returns the exit code for them
+func reportErrors(errors []*parser.ParseError) int {
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return 0
+}
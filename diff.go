@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is how many unchanged lines a hunk shows around a change
+const context = 3
+
+// diff returns the unified diff between the lines of a and b, or nothing
+// when they are the same. The lines that stay are found with the algorithm
+// of Myers, its time grows with the size of the input times the number of
+// changes and it needs memory only for the size of the input
+func diff(name string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	x, y := lines(a), lines(b)
+
+	d := &differ{x: x, y: y, removed: make([]bool, len(x)), added: make([]bool, len(y))}
+	d.compare(0, len(x), 0, len(y))
+
+	// Every line of the diff, with the line numbers it has in a and b
+	type edit struct {
+		op   byte // ' ', '-' or '+'
+		text string
+		i, j int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && d.removed[i]:
+			edits = append(edits, edit{'-', x[i], i, j})
+			i++
+		case j < len(y) && d.added[j]:
+			edits = append(edits, edit{'+', y[j], i, j})
+			j++
+		default:
+			edits = append(edits, edit{' ', x[i], i, j})
+			i++
+			j++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+
+		// A hunk goes on as long as the next change is close enough
+		first := max(k-context, 0)
+		last := k
+		for n := k; n < len(edits) && n <= last+2*context; n++ {
+			if edits[n].op != ' ' {
+				last = n
+			}
+		}
+		end := min(last+context+1, len(edits))
+
+		var removed, added int
+		for _, e := range edits[first:end] {
+			if e.op != '+' {
+				removed++
+			}
+			if e.op != '-' {
+				added++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(edits[first].i, removed), hunkRange(edits[first].j, added))
+		for _, e := range edits[first:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.text)
+		}
+		k = end
+	}
+	return out.Bytes()
+}
+
+// hunkRange is the start and length of a hunk, the lines start at 1 and
+// an empty hunk starts at the line before it
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// lines splits src after every newline, a last line without one gets it
+// with a note, like diff does
+func lines(src []byte) []string {
+	list := strings.SplitAfter(string(src), "\n")
+	if list[len(list)-1] == "" {
+		return list[:len(list)-1]
+	}
+	list[len(list)-1] += "\n\\ No newline at end of file\n"
+	return list
+}
+
+// differ marks the lines of x that are removed and the lines of y that
+// are added, the rest of the lines are the same in both
+type differ struct {
+	x, y           []string
+	removed, added []bool
+}
+
+// compare marks the changes between x[x0:x1] and y[y0:y1]. It splits them
+// in two at the middle of the shortest way from one to the other, and goes
+// on with both halves
+func (d *differ) compare(x0, x1, y0, y1 int) {
+	for x0 < x1 && y0 < y1 && d.x[x0] == d.y[y0] {
+		x0++
+		y0++
+	}
+	for x0 < x1 && y0 < y1 && d.x[x1-1] == d.y[y1-1] {
+		x1--
+		y1--
+	}
+
+	xm, ym, ok := d.split(x0, x1, y0, y1)
+	if !ok || xm == x0 && ym == y0 || xm == x1 && ym == y1 {
+		for i := x0; i < x1; i++ {
+			d.removed[i] = true
+		}
+		for j := y0; j < y1; j++ {
+			d.added[j] = true
+		}
+		return
+	}
+	d.compare(x0, xm, y0, ym)
+	d.compare(xm, x1, ym, y1)
+}
+
+// split looks for the shortest way from x[x0:x1] to y[y0:y1] from both
+// ends at once, and returns where the two searches meet
+func (d *differ) split(x0, x1, y0, y1 int) (xm, ym int, ok bool) {
+	n, m := x1-x0, y1-y0
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	// forward[k] is how far in x the search from the start got on the
+	// diagonal x-y == k, backward the same from the end. Both are moved
+	// by offset, k can be negative
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	odd := delta%2 != 0
+	var fstart, fend, bstart, bend int
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + fstart; k <= step-fend; k += 2 {
+			var x int
+			if k == -step || k != step && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x0+x] == d.y[y0+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				fend += 2
+			case y > m:
+				fstart += 2
+			case odd:
+				if b := offset + delta - k; b >= 0 && b < len(backward) && backward[b] != -1 && x >= n-backward[b] {
+					return x0 + x, y0 + y, true
+				}
+			}
+		}
+
+		for k := -step + bstart; k <= step-bend; k += 2 {
+			var x int
+			if k == -step || k != step && backward[offset+k-1] < backward[offset+k+1] {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x1-x-1] == d.y[y1-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				bend += 2
+			case y > m:
+				bstart += 2
+			case !odd:
+				if f := offset + delta - k; f >= 0 && f < len(forward) && forward[f] != -1 && forward[f] >= n-x {
+					fx := forward[f]
+					return x0 + fx, y0 + fx - (f - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
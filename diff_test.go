@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{
+			"insertion",
+			"a\nb\nc\n",
+			"a\nb\nx\nc\n",
+			"--- f.orig\n+++ f\n@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n",
+		},
+		{
+			"deletion",
+			"a\nb\nc\nd\ne\nf\ng\nh\n",
+			"a\nb\nc\nd\nf\ng\nh\n",
+			"--- f.orig\n+++ f\n@@ -2,7 +2,6 @@\n b\n c\n d\n-e\n f\n g\n h\n",
+		},
+		{
+			"change",
+			"let x = 1;\n",
+			"let x = 2;\n",
+			"--- f.orig\n+++ f\n@@ -1 +1 @@\n-let x = 1;\n+let x = 2;\n",
+		},
+		{
+			"empty",
+			"",
+			"a\n",
+			"--- f.orig\n+++ f\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"no newline",
+			"a\nb",
+			"a\nb\n",
+			"--- f.orig\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"two hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			"--- f.orig\n+++ f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got := string(diff("f", []byte(tt.a), []byte(tt.b)))
+		if got != tt.expected {
+			t.Errorf("%s: wrong diff.\ngot:\n%s\nwant:\n%s", tt.name, got, tt.expected)
+		}
+	}
+}
+
+// A big file with a few changes doesn't need memory for every pair of lines
+func TestDiffBigInput(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 200000; i++ {
+		line := strings.Repeat("x", i%7) + "\n"
+		a.WriteString(line)
+		if i == 100000 {
+			b.WriteString("changed\n")
+		}
+		b.WriteString(line)
+	}
+
+	got := string(diff("f", []byte(a.String()), []byte(b.String())))
+	expected := "--- f.orig\n+++ f\n@@ -99998,6 +99998,7 @@\n" +
+		" xx\n xxx\n xxxx\n+changed\n xxxxx\n xxxxxx\n \n"
+	if got != expected {
+		t.Errorf("wrong diff.\ngot:\n%s\nwant:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,199 @@
+// Package format prints Monkey programs in their canonical form, the way
+// gofmt does it for Go. The layout of the source doesn't matter, only its
+// syntax tree and its comments do:
+//
+//   - statements go on lines of their own, blocks are indented with tabs
+//   - let, return and expression statements end with a semicolon
+//   - binary operators have a space on both sides, parentheses are only
+//     kept where the precedences need them
+//   - a call, array or hash that doesn't fit into the line gets an element
+//     per line, and so does one where the source put the first element on
+//     a new line
+//   - comments stay where they were, a single empty line between two
+//     statements is kept
+//
+// Formatting formatted source gives the same source again
+package format
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/lexer"
+	"github.com/thewebdevel/monkey-interpreter/parser"
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+// Source formats the program src. A program with parse errors isn't
+// formatted, the errors are returned instead. filename is only used in
+// their positions, it can be empty
+func Source(filename string, src []byte) ([]byte, error) {
+	l := lexer.New(string(src), lexer.WithFilename(filename), lexer.WithTrivia())
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errs := p.Errors(); len(errs) > 0 {
+		list := make([]error, len(errs))
+		for i, err := range errs {
+			list[i] = err
+		}
+		return nil, errors.Join(list...)
+	}
+
+	pr := newPrinter()
+	pr.scan(string(src))
+	pr.program(program)
+	if pr.err != nil {
+		return nil, pr.err
+	}
+
+	return pr.out.Bytes(), nil
+}
+
+// Node writes node to w in the canonical form. node can be a Program, a
+// statement or an expression. It has no comments to keep, use Source for
+// that
+func Node(w io.Writer, node ast.Node) error {
+	pr := newPrinter()
+	switch n := node.(type) {
+	case *ast.Program:
+		pr.program(n)
+	case ast.Statement:
+		pr.statement(n, nil)
+	case ast.Expression:
+		pr.expr(n)
+	default:
+		return fmt.Errorf("format: unexpected node type %T", node)
+	}
+	if pr.err != nil {
+		return pr.err
+	}
+
+	_, err := w.Write(pr.out.Bytes())
+	return err
+}
+
+// comment is a comment of the source, it's printed close to the node
+// that comes after it
+type comment struct {
+	token.Trivia
+	trailing    bool // it's on the same line as the source before it
+	blankBefore bool // there's an empty line in front of it
+}
+
+// scan collects the comments of src and finds the closing bracket of every
+// opening one. The parser doesn't keep either of them
+func (p *printer) scan(src string) {
+	l := lexer.New(src, lexer.WithTrivia())
+
+	var open []int
+	first := true
+	for {
+		tok := l.NextToken()
+
+		newlines := 0
+		for _, t := range tok.LeadingTrivia {
+			if t.Kind == token.WHITESPACE {
+				newlines += strings.Count(t.Text, "\n")
+				continue
+			}
+			p.comments = append(p.comments, comment{
+				Trivia:      t,
+				trailing:    !first && newlines == 0,
+				blankBefore: newlines > 1,
+			})
+			newlines = 0
+		}
+		for _, t := range tok.TrailingTrivia {
+			if t.Kind != token.WHITESPACE {
+				p.comments = append(p.comments, comment{Trivia: t, trailing: true})
+			}
+		}
+
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			open = append(open, tok.Start.Offset)
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if n := len(open); n > 0 {
+				p.closing[open[n-1]] = tok.Start.Offset
+				open = open[:n-1]
+			}
+		case token.EOF:
+			return
+		}
+		first = false
+	}
+}
+
+// hasComment reports whether a comment that's not printed yet comes
+// before offset
+func (p *printer) hasComment(offset int) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Start.Offset < offset
+}
+
+// hasLineComment reports whether a line comment comes before offset
+func (p *printer) hasLineComment(offset int) bool {
+	for _, c := range p.comments[p.next:] {
+		if c.Start.Offset >= offset {
+			break
+		}
+		if c.Kind == token.LINE_COMMENT {
+			return true
+		}
+	}
+	return false
+}
+
+// flushComments prints the comments before offset where a statement or an
+// element of a list can go. A comment that was on the line of the code
+// before it stays there, the others get a line of their own. So does a
+// comment after code that isn't printed, like a ( that's left out
+func (p *printer) flushComments(offset int) {
+	for p.hasComment(offset) {
+		c := p.comments[p.next]
+		p.next++
+
+		if c.trailing && p.lineCode && !p.lineEnded {
+			p.writeComment(" ", c.Trivia)
+			continue
+		}
+		p.linebreak(c.blankBefore)
+		p.writeComment("", c.Trivia)
+		p.afterOpen = false
+	}
+}
+
+// inlineComments prints the comments before offset in the middle of an
+// expression. After a line comment the expression goes on in the next line
+func (p *printer) inlineComments(offset int) {
+	for p.hasComment(offset) {
+		c := p.comments[p.next]
+		p.next++
+
+		if !p.lineStart && !p.endsWith(' ') && !p.endsWith('(') && !p.endsWith('[') {
+			p.write(" ")
+		}
+		p.writeComment("", c.Trivia)
+		if c.Kind == token.LINE_COMMENT {
+			// The rest of the expression is indented once more
+			p.newline()
+			p.write("\t")
+		} else {
+			p.write(" ")
+		}
+	}
+}
+
+// blankBefore reports whether the source has an empty line right in front
+// of tok. An empty line before the comments of tok belongs to the comments
+func blankBefore(tok token.Token) bool {
+	n := len(tok.LeadingTrivia)
+	if n == 0 {
+		return false
+	}
+	last := tok.LeadingTrivia[n-1]
+	return last.Kind == token.WHITESPACE && strings.Count(last.Text, "\n") > 1
+}
@@ -0,0 +1,225 @@
+package format
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/lexer"
+	"github.com/thewebdevel/monkey-interpreter/parser"
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files")
+
+// Every testdata/*.input is formatted and compared to its .golden file.
+// Formatting the .golden file must give it back unchanged
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test files in testdata")
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Source(input, src)
+			if err != nil {
+				t.Fatalf("Source returned an error: %v", err)
+			}
+
+			golden := strings.TrimSuffix(input, ".input") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("formatted %s wrong.\ngot:\n%s\nwant:\n%s", input, got, want)
+			}
+
+			again, err := Source(golden, want)
+			if err != nil {
+				t.Fatalf("Source returned an error for the golden file: %v", err)
+			}
+			if !bytes.Equal(again, want) {
+				t.Errorf("formatting %s isn't idempotent.\ngot:\n%s\nwant:\n%s", golden, again, want)
+			}
+
+			checkSameProgram(t, src, got)
+			checkSameComments(t, src, got)
+		})
+	}
+}
+
+// checkSameProgram makes sure the formatted source means the same as the
+// source
+func checkSameProgram(t *testing.T, src, formatted []byte) {
+	t.Helper()
+
+	before := parser.New(lexer.New(string(src))).ParseProgram().String()
+	after := parser.New(lexer.New(string(formatted))).ParseProgram().String()
+	if before != after {
+		t.Errorf("formatting changed the program.\nbefore: %s\nafter:  %s", before, after)
+	}
+}
+
+// checkSameComments makes sure no comment got lost or moved past another
+func checkSameComments(t *testing.T, src, formatted []byte) {
+	t.Helper()
+
+	before, after := comments(string(src)), comments(string(formatted))
+	if strings.Join(before, "\n") != strings.Join(after, "\n") {
+		t.Errorf("formatting changed the comments.\nbefore: %q\nafter:  %q", before, after)
+	}
+}
+
+func comments(src string) []string {
+	var list []string
+	l := lexer.New(src, lexer.WithTrivia())
+	for {
+		tok := l.NextToken()
+		for _, trivia := range append(tok.LeadingTrivia, tok.TrailingTrivia...) {
+			if trivia.Kind != token.WHITESPACE {
+				list = append(list, trivia.Text)
+			}
+		}
+		if tok.Type == token.EOF {
+			return list
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"let add = fn(a,b){a+b}", "let add = fn(a, b) {\n\ta + b;\n};\n"},
+		{"((1 + 2)) * (3)", "(1 + 2) * 3;\n"},
+		{"return", "return;\n"},
+		{"if (x) { y } else { z }", "if (x) {\n\ty;\n} else {\n\tz;\n}\n"},
+		{"f(1,2,)", "f(1, 2);\n"},
+		{"[\n1, 2]", "[\n\t1,\n\t2,\n];\n"},
+		{"({})", "({});\n"},
+		{"", ""},
+		{"// only a comment", "// only a comment\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned an error: %v", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSourceLongCall(t *testing.T) {
+	input := "call(" + strings.Repeat("argument, ", 10) + "last)"
+	got, err := Source("", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "call(\n" + strings.Repeat("\targument,\n", 10) + "\tlast,\n);\n"
+	if string(got) != want {
+		t.Errorf("long call wrong.\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	for _, line := range strings.Split(string(got), "\n") {
+		if len(line) > maxWidth {
+			t.Errorf("line is longer than %d: %q", maxWidth, line)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("bad.mk", []byte("let = 5;"))
+	if err == nil {
+		t.Fatal("expected an error for a program that doesn't parse")
+	}
+	if !strings.Contains(err.Error(), "bad.mk:1:5") {
+		t.Errorf("the error has no position: %v", err)
+	}
+}
+
+// We construct the AST by hand, it has no positions and no comments
+func TestNode(t *testing.T) {
+	node := &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let"},
+		Name: &ast.Identifier{
+			Token: token.Token{Type: token.IDENT, Literal: "x"},
+			Value: "x",
+		},
+		Value: &ast.InfixExpression{
+			Token: token.Token{Type: token.ASTERISK, Literal: "*"},
+			Left: &ast.InfixExpression{
+				Token:    token.Token{Type: token.PLUS, Literal: "+"},
+				Left:     &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+				Operator: "+",
+				Right:    &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2},
+			},
+			Operator: "*",
+			Right:    &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "3"}, Value: 3},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Node(&out, node); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "let x = (1 + 2) * 3;" {
+		t.Errorf("Node wrong. got=%q", out.String())
+	}
+
+	out.Reset()
+	if err := Node(&out, &ast.LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}}); err == nil {
+		t.Errorf("expected an error for a let statement without a name, got %q", out.String())
+	}
+}
+
+// FuzzSource formats random programs. Whatever Source makes of a program
+// must parse, and formatting it again must not change it
+func FuzzSource(f *testing.F) {
+	inputs, _ := filepath.Glob(filepath.Join("testdata", "*.input"))
+	for _, input := range inputs {
+		if src, err := os.ReadFile(input); err == nil {
+			f.Add(string(src))
+		}
+	}
+	f.Add("(/* b */ x)")
+	f.Add("( # c\n 1() - x )")
+	f.Add("f(1, // one\n2)")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		got, err := Source("", []byte(input))
+		if err != nil {
+			return
+		}
+		again, err := Source("", got)
+		if err != nil {
+			t.Fatalf("formatted program doesn't parse: %v\n%s", err, got)
+		}
+		if !bytes.Equal(again, got) {
+			t.Fatalf("formatting isn't idempotent.\nfirst:\n%s\nsecond:\n%s", got, again)
+		}
+	})
+}
@@ -0,0 +1,656 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/parser"
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+const (
+	// maxWidth is the number of columns a line should fit into
+	maxWidth = 80
+	// tabWidth is the number of columns a tab counts for
+	tabWidth = 4
+)
+
+// printer writes a syntax tree as source to out
+type printer struct {
+	out       bytes.Buffer
+	indent    int  // the number of tabs in front of a new line
+	col       int  // the column the next char goes into, starting at 0
+	lineStart bool // nothing was written into the current line yet
+	lineCode  bool // the current line has code, not only comments
+	lineEnded bool // the current line ends with a line comment
+	afterOpen bool // nothing was written since a { or the start of the file
+
+	comments []comment
+	next     int         // the first comment that's not printed yet
+	closing  map[int]int // the offset of every opening bracket to its closing one
+
+	// widths holds the width of every expression that was measured, -1
+	// for an expression that takes more than one line
+	widths    map[ast.Node]int
+	measuring bool // the printer is a measurer, see measurer
+
+	// hashParens is a hash literal that has to be put in parentheses, since
+	// it starts an expression statement and would look like a block
+	hashParens ast.Node
+
+	err error
+}
+
+func newPrinter() *printer {
+	return &printer{
+		lineStart: true,
+		afterOpen: true,
+		closing:   map[int]int{},
+		widths:    map[ast.Node]int{},
+	}
+}
+
+// write writes s, which is part of a single line. The indentation is
+// written with the first text of a line
+func (p *printer) write(s string) {
+	if s == "" {
+		return
+	}
+	// Anything after a line comment would be part of it
+	if p.lineEnded {
+		p.newline()
+	}
+	if p.lineStart {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.col = p.indent * tabWidth
+		p.lineStart = false
+	}
+	p.out.WriteString(s)
+	p.lineCode = true
+
+	// A block comment can span lines
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.lineStart = true
+	p.lineCode = false
+	p.lineEnded = false
+	p.col = 0
+}
+
+// writeComment writes c after sep, a comment doesn't count as code
+func (p *printer) writeComment(sep string, c token.Trivia) {
+	code := p.lineCode
+	p.write(sep + c.Text)
+	p.lineCode = code
+	p.lineEnded = c.Kind == token.LINE_COMMENT
+}
+
+// linebreak starts the line for a statement, a comment or an element of a
+// list. With blank there's an empty line in between, but not right after an
+// opening bracket
+func (p *printer) linebreak(blank bool) {
+	if p.out.Len() == 0 {
+		return
+	}
+	if !p.lineStart {
+		p.newline()
+	}
+	if blank && !p.afterOpen {
+		p.newline()
+	}
+}
+
+func (p *printer) endsWith(b byte) bool {
+	data := p.out.Bytes()
+	return len(data) > 0 && data[len(data)-1] == b
+}
+
+// offset returns the offset of pos, or -1 for a node that didn't come from
+// the source. Nothing comes before -1, so no comments are printed for it
+func offset(pos token.Position) int {
+	if !pos.IsValid() {
+		return -1
+	}
+	return pos.Offset
+}
+
+// closingOffset returns the offset of the bracket that closes the one at
+// open, -1 if it isn't known
+func (p *printer) closingOffset(open token.Position) int {
+	if c, ok := p.closing[offset(open)]; ok && open.IsValid() {
+		return c
+	}
+	return -1
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements)
+	p.flushComments(math.MaxInt)
+	if p.out.Len() > 0 {
+		p.newline()
+	}
+}
+
+// statements writes each statement on a line of its own
+func (p *printer) statements(list []ast.Statement) {
+	for i, s := range list {
+		var next ast.Statement
+		if i+1 < len(list) {
+			next = list[i+1]
+		}
+
+		tok := firstToken(s)
+		p.flushComments(offset(tok.Start))
+		p.linebreak(blankBefore(tok))
+
+		// The comments after a ( that's left out go on lines of their own,
+		// in front of the statement, where they are the next time
+		if start := statementStart(s); p.hasComment(start) {
+			p.flushComments(start)
+			p.linebreak(false)
+		}
+		p.statement(s, next)
+		p.afterOpen = false
+	}
+}
+
+// statement writes s, next is the statement that comes after it in the
+// same list
+func (p *printer) statement(s ast.Statement, next ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		if s.Name == nil {
+			p.fail(s)
+			return
+		}
+		p.write("let " + s.Name.Value + " = ")
+		p.expr(s.Value)
+		p.write(";")
+
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expr(s.ReturnValue)
+		}
+		p.write(";")
+
+	case *ast.ExpressionStatement:
+		p.expressionStatement(s)
+		if !p.canOmitSemicolon(s, next) {
+			p.write(";")
+		}
+
+	case *ast.BlockStatement:
+		p.block(s)
+
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expr(s.Condition)
+		p.write(") ")
+		p.block(s.Body)
+
+	case *ast.ForStatement:
+		p.write("for (")
+		switch init := s.Init.(type) {
+		case *ast.LetStatement:
+			if init.Name == nil {
+				p.fail(init)
+				return
+			}
+			p.write("let " + init.Name.Value + " = ")
+			p.expr(init.Value)
+		case *ast.ExpressionStatement:
+			p.expressionStatement(init)
+		}
+		p.write(";")
+		if s.Condition != nil {
+			p.write(" ")
+			p.expr(s.Condition)
+		}
+		p.write(";")
+		if s.Post != nil {
+			p.write(" ")
+			p.expr(s.Post)
+		}
+		p.write(") ")
+		p.block(s.Body)
+
+	case *ast.BreakStatement:
+		p.write("break;")
+
+	case *ast.ContinueStatement:
+		p.write("continue;")
+
+	default:
+		p.fail(s)
+	}
+}
+
+// expressionStatement writes the expression of s. A hash literal at its
+// start goes into parentheses, the parser would take its { for a block
+func (p *printer) expressionStatement(s *ast.ExpressionStatement) {
+	if hash, ok := p.leftmost(s.Expression).(*ast.HashLiteral); ok {
+		p.hashParens = hash
+	}
+	p.expr(s.Expression)
+	p.hashParens = nil
+}
+
+// canOmitSemicolon reports whether the ; after s can be left out. That's
+// the case for an if, which ends with a } like the statements do, unless
+// the statement after it could go on with the if, like -x or (x) would
+func (p *printer) canOmitSemicolon(s *ast.ExpressionStatement, next ast.Statement) bool {
+	if _, ok := s.Expression.(*ast.IfExpression); !ok {
+		return false
+	}
+	if next == nil {
+		return true
+	}
+
+	q := p.measurer()
+	q.statement(next, nil)
+	r, _ := utf8.DecodeRune(q.out.Bytes())
+	return r != '(' && r != '[' && r != '-'
+}
+
+// block writes a block, the statements go on lines of their own between
+// the braces
+func (p *printer) block(b *ast.BlockStatement) {
+	if b == nil {
+		p.write("{}")
+		return
+	}
+
+	end := p.closingOffset(b.Token.Start)
+	p.write("{")
+	if len(b.Statements) == 0 && !p.hasComment(end) {
+		p.write("}")
+		return
+	}
+
+	p.indent++
+	p.afterOpen = true
+	p.statements(b.Statements)
+	p.flushComments(end)
+	p.indent--
+	p.linebreak(false)
+	p.write("}")
+}
+
+// The precedences of the nodes that aren't infix expressions. The ones
+// that can't be split up, like literals and calls, bind the tightest
+const (
+	prefixPrecedence = parser.PREFIX
+	atomPrecedence   = parser.INDEX + 1
+)
+
+func (p *printer) expr(e ast.Expression) {
+	if e == nil {
+		p.fail(e)
+		return
+	}
+	p.inlineComments(offset(start(e)))
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.write(literal(e.Token, strconv.FormatInt(e.Value, 10)))
+
+	case *ast.FloatLiteral:
+		p.write(literal(e.Token, strconv.FormatFloat(e.Value, 'g', -1, 64)))
+
+	case *ast.StringLiteral:
+		p.write(e.String())
+
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(e.Value))
+
+	case *ast.NullLiteral:
+		p.write("null")
+
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		// A keyword operator needs a space, not x and not (x)
+		if r, _ := utf8.DecodeLastRuneInString(e.Operator); unicode.IsLetter(r) {
+			p.write(" ")
+		}
+		p.operand(e.Right, precedence(e.Right) < prefixPrecedence)
+
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		right := rightAssociative(e)
+		left := precedence(e.Left)
+		p.operand(e.Left, left < prec || left == prec && right)
+		p.write(" " + e.Operator + " ")
+		r := precedence(e.Right)
+		p.operand(e.Right, r < prec || r == prec && !right)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expr(e.Condition)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			params[i] = param.Value
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		broken := p.tooWide(e)
+		p.operand(e.Function, precedence(e.Function) < atomPrecedence)
+		p.list("(", ")", e.Token.Start, broken, len(e.Arguments), func(i int) ast.Expression {
+			return e.Arguments[i]
+		}, func(i int) {
+			p.expr(e.Arguments[i])
+		})
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", e.Token.Start, p.tooWide(e), len(e.Elements), func(i int) ast.Expression {
+			return e.Elements[i]
+		}, func(i int) {
+			p.expr(e.Elements[i])
+		})
+
+	case *ast.HashLiteral:
+		parens := p.hashParens == e
+		p.hashParens = nil
+		if parens {
+			p.write("(")
+		}
+		p.list("{", "}", e.Token.Start, p.tooWide(e), len(e.Pairs), func(i int) ast.Expression {
+			return e.Pairs[i].Key
+		}, func(i int) {
+			p.expr(e.Pairs[i].Key)
+			p.write(": ")
+			p.expr(e.Pairs[i].Value)
+		})
+		if parens {
+			p.write(")")
+		}
+
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < atomPrecedence)
+		p.write("[")
+		p.expr(e.Index)
+		p.write("]")
+
+	case *ast.SliceExpression:
+		p.operand(e.Left, precedence(e.Left) < atomPrecedence)
+		p.write("[")
+		if e.Low != nil {
+			p.expr(e.Low)
+		}
+		p.write(":")
+		if e.High != nil {
+			p.expr(e.High)
+		}
+		p.write("]")
+
+	default:
+		p.fail(e)
+	}
+}
+
+// operand writes e, in parentheses when parens is set
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if !parens {
+		p.expr(e)
+		return
+	}
+	p.inlineComments(offset(start(e)))
+	p.write("(")
+	p.expr(e)
+	p.write(")")
+}
+
+// list writes the elements of a call, an array or a hash between open and
+// close. The list is broken into an element per line, with a comma after
+// each one, if broken is set, if the source did it or if there are line
+// comments in it. elem returns the expression an element starts with and write
+// writes an element
+func (p *printer) list(open, close string, openPos token.Position, broken bool, n int,
+	elem func(i int) ast.Expression, write func(i int)) {
+	end := p.closingOffset(openPos)
+	if n > 0 && openPos.IsValid() && start(elem(0)).Line > openPos.Line {
+		broken = true
+	}
+	if p.hasLineComment(end) {
+		broken = true
+	}
+
+	p.write(open)
+	if !broken {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			write(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	p.afterOpen = true
+	for i := 0; i < n; i++ {
+		p.flushComments(offset(start(elem(i))))
+		p.linebreak(false)
+		write(i)
+		p.write(",")
+		p.afterOpen = false
+	}
+	p.flushComments(end)
+	p.indent--
+	p.linebreak(false)
+	p.write(close)
+}
+
+// tooWide reports whether e doesn't fit into the rest of the line. An
+// expression with more than one line is never too wide, like a call with a
+// function literal in it, it's the lines of the function that count
+func (p *printer) tooWide(e ast.Expression) bool {
+	if p.measuring {
+		return false
+	}
+	width, ok := p.widths[e]
+	if !ok {
+		q := p.measurer()
+		q.expr(e)
+		width = -1
+		if !bytes.ContainsRune(q.out.Bytes(), '\n') {
+			width = utf8.RuneCount(q.out.Bytes())
+		}
+		p.widths[e] = width
+	}
+	return width >= 0 && p.col+width > maxWidth
+}
+
+// measurer returns a printer that writes on a line of its own, without
+// comments, to find out how the output of p is going to look. It doesn't
+// break lists that are too wide, the width is what it measures
+func (p *printer) measurer() *printer {
+	q := newPrinter()
+	q.widths = p.widths
+	q.lineStart = false
+	q.measuring = true
+	return q
+}
+
+func (p *printer) fail(node ast.Node) {
+	if p.err == nil {
+		p.err = fmt.Errorf("format: can't format %s", describe(node))
+	}
+}
+
+func describe(node ast.Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "a missing node"
+	case *ast.BadStatement:
+		return "a bad statement at " + n.Token.Start.String()
+	case *ast.BadExpression:
+		return "a bad expression at " + n.Token.Start.String()
+	}
+	return fmt.Sprintf("a %T", node)
+}
+
+// leftmost returns the node the source of e starts with, when it's not in
+// parentheses
+func (p *printer) leftmost(e ast.Expression) ast.Expression {
+	switch n := e.(type) {
+	case *ast.InfixExpression:
+		left := precedence(n.Left)
+		if left < precedence(n) || left == precedence(n) && rightAssociative(n) {
+			return nil
+		}
+		return p.leftmost(n.Left)
+	case *ast.CallExpression:
+		return p.leftmostOperand(n.Function)
+	case *ast.IndexExpression:
+		return p.leftmostOperand(n.Left)
+	case *ast.SliceExpression:
+		return p.leftmostOperand(n.Left)
+	}
+	return e
+}
+
+func (p *printer) leftmostOperand(e ast.Expression) ast.Expression {
+	if precedence(e) < atomPrecedence {
+		return nil
+	}
+	return p.leftmost(e)
+}
+
+// precedence returns how tightly e holds together, compared to the
+// operators around it
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(operator(e))
+	case *ast.PrefixExpression:
+		return prefixPrecedence
+	}
+	return atomPrecedence
+}
+
+func rightAssociative(e *ast.InfixExpression) bool {
+	return parser.RightAssociative(operator(e))
+}
+
+// operator returns the token type of the operator of e. The operator is
+// what's printed, a node made by hand doesn't have to have a token
+func operator(e *ast.InfixExpression) token.TokenType {
+	if t, ok := token.LookupOperator(e.Operator); ok {
+		return t
+	}
+	return e.Token.Type
+}
+
+// literal returns the literal of a number as it was written, ex: 0x1F, or
+// value for a node that was made by hand
+func literal(tok token.Token, value string) string {
+	if tok.Literal != "" {
+		return tok.Literal
+	}
+	return value
+}
+
+// statementStart returns the offset where the printed s starts. The token
+// of an expression statement can be a ( that isn't printed
+func statementStart(s ast.Statement) int {
+	if es, ok := s.(*ast.ExpressionStatement); ok && es.Expression != nil {
+		return max(offset(es.Token.Start), offset(start(es.Expression)))
+	}
+	return offset(firstToken(s).Start)
+}
+
+// start returns the position of the first token of e
+func start(e ast.Expression) token.Position {
+	switch n := e.(type) {
+	case *ast.InfixExpression:
+		return start(n.Left)
+	case *ast.CallExpression:
+		return start(n.Function)
+	case *ast.IndexExpression:
+		return start(n.Left)
+	case *ast.SliceExpression:
+		return start(n.Left)
+	case nil:
+		return token.Position{}
+	}
+	return firstToken(e).Start
+}
+
+// firstToken returns the Token field of node. For a statement that's the
+// token it starts with
+func firstToken(node ast.Node) token.Token {
+	switch n := node.(type) {
+	case *ast.LetStatement:
+		return n.Token
+	case *ast.ReturnStatement:
+		return n.Token
+	case *ast.ExpressionStatement:
+		return n.Token
+	case *ast.BlockStatement:
+		return n.Token
+	case *ast.WhileStatement:
+		return n.Token
+	case *ast.ForStatement:
+		return n.Token
+	case *ast.BreakStatement:
+		return n.Token
+	case *ast.ContinueStatement:
+		return n.Token
+	case *ast.BadStatement:
+		return n.Token
+	case *ast.Identifier:
+		return n.Token
+	case *ast.IntegerLiteral:
+		return n.Token
+	case *ast.FloatLiteral:
+		return n.Token
+	case *ast.StringLiteral:
+		return n.Token
+	case *ast.Boolean:
+		return n.Token
+	case *ast.NullLiteral:
+		return n.Token
+	case *ast.PrefixExpression:
+		return n.Token
+	case *ast.IfExpression:
+		return n.Token
+	case *ast.FunctionLiteral:
+		return n.Token
+	case *ast.ArrayLiteral:
+		return n.Token
+	case *ast.HashLiteral:
+		return n.Token
+	case *ast.BadExpression:
+		return n.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,21 @@
+// Package corpus has the Monkey programs the benchmarks of the lexer and the
+// parser run on, so that both measure the same input
+package corpus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Benchmark generates a large Monkey program, about 1MB of source
+func Benchmark() string {
+	var out strings.Builder
+	for i := 0; out.Len() < 1<<20; i++ {
+		fmt.Fprintf(&out, "let value%d = (alpha + %d) * beta - gamma / 0x%X; # comment %d\n", i, i, i, i)
+		fmt.Fprintf(&out, "let name%d = \"string number %d\\n\";\n", i, i)
+		fmt.Fprintf(&out, "result%d <= %d.5 && !done || count%d != %d ** 2;\n", i, i, i, i)
+		fmt.Fprintf(&out, "return value%d |> f;\n", i)
+	}
+
+	return out.String()
+}
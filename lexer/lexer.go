@@ -1,23 +1,148 @@
 package lexer
 
 import (
+	"bufio"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/thewebdevel/monkey-interpreter/token"
 )
 
+// eof is the value of ch once the whole input has been read. It is not a
+// valid rune, so it can never be confused with a character of the input
+const eof = -1
+
 // Lexer is of type struct. `readPosition` always points to the next char of our input
 // Which helps us to peek while `positon` points to the character
-// in the input coressponds to the `ch` byte
+// in the input coressponds to the `ch` rune
+//
+// The input is decoded as UTF-8, one rune at a time. position and
+// readPosition are byte offsets, while column counts runes
+//
+// The input is either a string (see New) or an io.Reader (see NewReader).
+// Only readChar, peekChar, text and rawChar care about the difference
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	filename     string // name of the source, used in token positions
+	position     int    // current position in input (points to current char)
+	readPosition int    // current reading position in input (after current char)
+	ch           rune   // current char under examination
+	width        int    // width of ch in bytes, 0 at the end of the input
+	line         int    // line of the current char, starting at 1
+	column       int    // column of the current char, starting at 1
+	errors       []Error
+
+	// Only used when reading from an io.Reader
+	reader      *bufio.Reader
+	chBytes     [utf8.UTFMax]byte // the bytes of ch
+	window      []byte            // the bytes read since windowStart
+	windowStart int               // offset of the first byte in window
+	discard     bool              // the bytes being read aren't needed, keep them out of window
+	readErr     error             // the first error returned by reader
+	readErrDone bool              // readErr was handed out as a token.ILLEGAL
+
+	keepTrivia bool           // whether whitespace and comments are kept
+	trivia     []token.Trivia // trivia read since the last token
+
+	// Operators and keywords added with WithOperator and WithKeyword, nil
+	// when there are none
+	operators map[string]token.TokenType
+	keywords  map[string]token.TokenType
+}
+
+// Error describes a problem found in the input, such as a character that
+// doesn't belong to the language. Every token.ILLEGAL token the lexer hands
+// out has a matching Error
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+// Error formats the error as position: message
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// Option configures a Lexer. Options are passed to New after the input
+type Option func(*Lexer)
+
+// WithFilename names the source that is being lexed. The name is stamped
+// on the position of every token, so errors can point to the right file
+func WithFilename(filename string) Option {
+	return func(l *Lexer) {
+		l.filename = filename
+	}
+}
+
+// WithTrivia makes the lexer keep whitespace and comments instead of
+// throwing them away. They are attached to the tokens as trivia:
+//
+//   - the trailing trivia of a token is the whitespace and line comment
+//     that follow it on the same line, up to but not including the newline
+//   - everything else in front of a token is its leading trivia, so a
+//     comment on a line of its own belongs to the token that comes after it
+//   - block comments are always leading trivia of the token after them
+//
+// Whatever is left at the end of the input is the leading trivia of the
+// token.EOF token. Putting together the leading trivia, the source text and
+// the trailing trivia of every token gives back the input exactly
+func WithTrivia() Option {
+	return func(l *Lexer) {
+		l.keepTrivia = true
+	}
+}
+
+// WithOperator makes the lexer read literal as an operator of type t, on
+// top of the built in operators. t is usually made with token.Register.
+// An operator is made of symbols like + or ., a word is a keyword instead,
+// see WithKeyword. A built in operator can't be replaced.
+//
+// The lexer reads the longest operator it finds. When the input only has
+// the start of a longer operator, like . for .., that part becomes a
+// token.ILLEGAL token unless it's an operator itself
+func WithOperator(literal string, t token.TokenType) Option {
+	return func(l *Lexer) {
+		if l.operators == nil {
+			l.operators = map[string]token.TokenType{}
+		}
+
+		// Every prefix has to be in the table, so the lexer keeps going while
+		// it reads the operator. The ones that aren't operators are ILLEGAL
+		for i := range literal {
+			prefix := literal[:i]
+			if _, ok := l.lookupOperator([]byte(prefix)); prefix != "" && !ok {
+				l.operators[prefix] = token.ILLEGAL
+			}
+		}
+
+		if _, ok := token.LookupOperator(literal); !ok {
+			l.operators[literal] = t
+		}
+	}
+}
+
+// WithKeyword makes the lexer read word as a keyword of type t instead of
+// an identifier. t is usually made with token.Register. A keyword that's
+// already built in is replaced
+func WithKeyword(word string, t token.TokenType) Option {
+	return func(l *Lexer) {
+		if l.keywords == nil {
+			l.keywords = map[string]token.TokenType{}
+		}
+		l.keywords[word] = t
+	}
 }
 
 // New function will use read char so that our *Lexer is in a fully working state
 // before anyone calls NextToken()
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+func New(input string, opts ...Option) *Lexer {
+	l := &Lexer{input: input, line: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
+
 	l.readChar()
 	return l
 }
@@ -25,78 +150,173 @@ func New(input string) *Lexer {
 // This function gives us the next character and advances our postion in
 // the input string.
 func (l *Lexer) readChar() {
-	// It first checks whether we reached our end of input, if that's the case,
-	// it sets l.ch to 0 which is the ASCII code for "NUL" and signifies
-	// either we haven't read anything end or end of file for us.
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		// But if we haven't it sets ch with the next character by accessing
-		// l.input[l.readPositon]
-		l.ch = l.input[l.readPosition]
+	// Once we moved past the end of the input there is nothing left to read,
+	// so we stay where we are. This keeps the position of repeated EOF tokens
+	// stable
+	if l.ch == eof {
+		return
+	}
+
+	// Moving past a newline starts a new line
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
 	}
 
 	// l.position is updated to the just used l.redPosition
-	// l.readPositon is incremented by 1
 	l.position = l.readPosition
-	l.readPosition++
+
+	if l.reader != nil {
+		l.readRune()
+	} else if l.readPosition >= len(l.input) {
+		// It first checks whether we reached our end of input, if that's the
+		// case, it sets l.ch to eof
+		l.ch, l.width = eof, 0
+	} else {
+		// But if we haven't it decodes the rune starting at l.readPosition.
+		// An invalid byte decodes to utf8.RuneError with a width of 1
+		l.ch, l.width = utf8.DecodeRuneInString(l.input[l.readPosition:])
+	}
+
+	// l.readPosition moves by the width of the char in bytes
+	l.readPosition += l.width
+	l.column++
+
+	// A failing reader ends the input, we report why it ended
+	if l.ch == eof && l.readErr != nil {
+		l.error(l.pos(), "read error: "+l.readErr.Error())
+	}
+}
+
+// invalidChar reports whether the current char is a byte that isn't valid UTF-8.
+// A correctly encoded U+FFFD is also decoded to utf8.RuneError, but it is
+// three bytes wide
+func (l *Lexer) invalidChar() bool {
+	return l.ch == utf8.RuneError && l.width == 1
+}
+
+// text returns the source text from start up to the current char
+func (l *Lexer) text(start token.Position) string {
+	if l.reader != nil {
+		return string(l.window[start.Offset-l.windowStart:])
+	}
+
+	return l.input[start.Offset:l.position]
+}
+
+// rawChar returns the bytes of the current char as they are in the input
+func (l *Lexer) rawChar() string {
+	if l.reader != nil {
+		return string(l.chBytes[:l.width])
+	}
+
+	return l.input[l.position:l.readPosition]
+}
+
+// error records a problem found at pos
+func (l *Lexer) error(pos token.Position, msg string) {
+	l.errors = append(l.errors, Error{Pos: pos, Msg: msg})
+}
+
+// Errors returns the problems found in the input so far
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+// pos returns the position of the current character
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 // NextToken function will look at the current character under examination (l.ch)
 // and return a token depending on which character it is
+//
+// Whitespace and comments between the tokens are skipped, or attached to
+// the token as trivia when the lexer was created with WithTrivia
 func (l *Lexer) NextToken() token.Token {
+	l.trivia = nil
+
+	// The text of the previous token is no longer needed
+	if l.reader != nil {
+		l.window = l.window[:0]
+		l.windowStart = l.position
+	}
+
+	// Skip whitespace and comments. Unless they are kept as trivia, a
+	// Lexer reading from an io.Reader forgets their text right away, a huge
+	// comment mustn't end up in memory
+	l.discard = l.reader != nil && !l.keepTrivia
+	start, ok := l.skipTrivia(false)
+	if l.discard {
+		l.discard = false
+		l.window = l.window[:0]
+		l.windowStart = l.position
+	}
+
+	// A block comment that is never closed swallows the rest of the input,
+	// we turn it into a token.ILLEGAL. Its literal is only the /* though,
+	// the rest of the input can be of any size
+	var tok token.Token
+	if ok {
+		tok = l.readToken()
+	} else {
+		l.error(start, "comment not terminated")
+		tok = token.Token{Type: token.ILLEGAL, Literal: "/*"}
+		tok.Start, tok.End = start, l.pos()
+		// The comment is the token, it's not trivia
+		if l.keepTrivia {
+			l.trivia = l.trivia[:len(l.trivia)-1]
+		}
+	}
+
+	if l.keepTrivia {
+		tok.LeadingTrivia = l.trivia
+		l.trivia = nil
+		l.skipTrivia(true)
+		tok.TrailingTrivia = l.trivia
+	}
+
+	// A failing reader ends the input early. Instead of an EOF that looks
+	// like the program is complete, the end is a token.ILLEGAL once, so
+	// whoever reads the tokens notices the error
+	if tok.Type == token.EOF && l.readErr != nil && !l.readErrDone {
+		l.readErrDone = true
+		tok.Type, tok.Literal = token.ILLEGAL, ""
+	}
+
+	return tok
+}
+
+// readToken reads the token starting at the current char. It expects
+// whitespace and comments to be skipped already
+func (l *Lexer) readToken() token.Token {
 	// Declare a variable tok of type token.Token
 	var tok token.Token
 
-	// Skip whiteslace
-	l.skipWhitespace()
+	// The token starts at the first character after the whitespace
+	start := l.pos()
 
 	// Based on the Character under examination
 	// return the appropriate chracter
 	switch l.ch {
-	case '=':
-		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+	case '"':
+		// A string literal. Its literal is the value of the string, without
+		// the quotes and with all escape sequences replaced. If the string is
+		// malformed the whole string becomes a token.ILLEGAL
+		if value, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Literal: value}
 		} else {
-			tok = newToken(token.ASSIGN, l.ch)
-		}
-	case '+':
-		tok = newToken(token.PLUS, l.ch)
-	case '-':
-		tok = newToken(token.MINUS, l.ch)
-	case '!':
-		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
-		} else {
-			tok = newToken(token.BANG, l.ch)
-		}
-	case '/':
-		tok = newToken(token.SLASH, l.ch)
-	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
-	case '<':
-		tok = newToken(token.LT, l.ch)
-	case '>':
-		tok = newToken(token.GT, l.ch)
-	case ';':
-		tok = newToken(token.SEMICOLON, l.ch)
-	case ',':
-		tok = newToken(token.COMMA, l.ch)
-	case '{':
-		tok = newToken(token.LBRACE, l.ch)
-	case '}':
-		tok = newToken(token.RBRACE, l.ch)
-	case '(':
-		tok = newToken(token.LPAREN, l.ch)
-	case ')':
-		tok = newToken(token.RPAREN, l.ch)
-	case 0:
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.text(start)}
+			tok.Start, tok.End = start, l.pos()
+			return tok
+		}
+	case eof:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
@@ -108,72 +328,497 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			// Check if the identifier is a keyword and assign the type appropriately
-			tok.Type = token.LookupIndent(tok.Literal)
+			tok.Type = l.lookupIdent(tok.Literal)
+			tok.Start, tok.End = start, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			// The literal of a number is its source text, the parser
+			// converts it to a value
+			tok.Type = l.readNumber()
+			tok.Literal = l.text(start)
+			tok.Start, tok.End = start, l.pos()
 			return tok
+		} else if tokenType, literal, ok := l.readOperator(); ok {
+			tok = token.Token{Type: tokenType, Literal: literal}
+			break
 		}
 		// If we don't know how to handle current chracter then we declare it as token.ILLEGAL
-		tok = newToken(token.ILLEGAL, l.ch)
+		// An invalid UTF-8 byte is kept as it is in the literal, so the literal
+		// still matches the source text
+		if l.invalidChar() {
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.rawChar()}
+			l.error(start, fmt.Sprintf("invalid UTF-8 encoding (byte %#x)", l.rawChar()[0]))
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+			l.error(start, fmt.Sprintf("unexpected character %q", l.ch))
+		}
 	}
 
 	l.readChar()
+	tok.Start, tok.End = start, l.pos()
 	return tok
 }
 
+// readOperator reads the longest operator or delimiter starting at the
+// current char, the operators themselves are listed in the token package.
+// It keeps adding the next char for as long as the result is still an operator,
+// so "**" is read as token.POWER and not as two token.ASTERISK.
+// When it returns, the current char is the last char of the operator
+func (l *Lexer) readOperator() (token.TokenType, string, bool) {
+	start := l.pos()
+
+	// The chars are collected in a small buffer on the stack, looking up
+	// a []byte converted to a string doesn't allocate
+	var buf [8]byte
+	literal := utf8.AppendRune(buf[:0], l.ch)
+	tokenType, ok := l.lookupOperator(literal)
+
+	for {
+		peek := l.peekChar()
+		if peek == eof {
+			break
+		}
+
+		longer := utf8.AppendRune(literal, peek)
+		longerType, longerOk := l.lookupOperator(longer)
+		if !longerOk {
+			break
+		}
+
+		l.readChar()
+		literal, tokenType, ok = longer, longerType, true
+	}
+
+	// We stopped in the middle of an operator added with WithOperator
+	if ok && tokenType == token.ILLEGAL {
+		l.error(start, fmt.Sprintf("unknown operator %q", string(literal)))
+		return token.ILLEGAL, string(literal), true
+	}
+
+	// The literal of a built in operator is its name, so there is no need to
+	// turn the buffer into a new string
+	if l.operators != nil {
+		if _, builtin := token.LookupOperator(string(literal)); !builtin {
+			return tokenType, string(literal), ok
+		}
+	}
+	return tokenType, tokenType.String(), ok
+}
+
+// lookupOperator looks up literal in the built in operators and the ones
+// added with WithOperator
+func (l *Lexer) lookupOperator(literal []byte) (token.TokenType, bool) {
+	if tokenType, ok := token.LookupOperator(string(literal)); ok {
+		return tokenType, true
+	}
+
+	tokenType, ok := l.operators[string(literal)]
+	return tokenType, ok
+}
+
+// lookupIdent is token.LookupIndent with the keywords added with WithKeyword
+func (l *Lexer) lookupIdent(ident string) token.TokenType {
+	if tokenType, ok := l.keywords[ident]; ok {
+		return tokenType
+	}
+
+	return token.LookupIndent(ident)
+}
+
 // This function helps us with initializing the tokens for NextToken()
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-// Reads an identifier and advances our lexer position until it encounters a non-letter-character
+// Reads an identifier and advances our lexer position until it encounters a
+// character that can't be part of an identifier
+//
+// An identifier starts with a letter and continues with letters and digits:
+//
+//	identifier = letter { letter | digit }
+//	letter     = any Unicode letter (category L) | "_"
+//	digit      = any Unicode decimal digit (category Nd)
+//
+// So foo_bar, x1, café and 名前 are all identifiers, but 1x is not
 func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
+	start := l.pos()
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	return l.text(start)
 }
 
 // Check if the current char is a letter
-func isLetter(ch byte) bool {
-	// We check if the current char falls in the alphabet range of both upper and lower case
+func isLetter(ch rune) bool {
+	// Any Unicode letter counts, not only the ASCII alphabet
 	// We also consider '_' as letter and allow it in identifier and keyword
 	// This means that we can use variables like foo_baar. Other program like
 	// ruby allows ? and ! so this is the place where we can sneak it in
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+// readNumber reads an integer or a floating point literal and returns
+// token.INT, token.FLOAT or token.ILLEGAL if the number is malformed.
+//
+//	int   = decimal | "0x" hex digits | "0o" octal digits | "0b" binary digits
+//	float = decimal "." decimal [ exponent ] | decimal exponent
+//	exponent = ( "e" | "E" ) [ "+" | "-" ] decimal
+//
+// A '_' may separate two digits or follow the base prefix, ex: 1_000_000
+// or 0x_FF. Decimal integers can't have leading zeros, so 0755 is an error
+// instead of silently being an octal number. A number can't be followed by
+// a letter, 12abc is an error and not 12 and abc.
+// Only the first problem of a number is reported
+func (l *Lexer) readNumber() token.TokenType {
+	start := l.pos()
+	tokenType := token.INT
+
+	var numErr *Error
+	fail := func(pos token.Position, msg string) {
+		if numErr == nil {
+			numErr = &Error{Pos: pos, Msg: msg}
+		}
+	}
+
+	base := 10
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	if base != 10 {
+		l.readChar()
+		l.readChar()
+		if l.readDigits(base, true, fail) == 0 {
+			fail(start, baseNames[base]+" literal has no digits")
+		}
+	} else {
+		l.readDigits(10, false, fail)
+
+		// A fraction needs a digit after the dot
+		if l.ch == '.' && isDigit(l.peekChar()) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readDigits(10, false, fail)
+		}
+
+		if l.ch == 'e' || l.ch == 'E' {
+			tokenType = token.FLOAT
+			exponent := l.pos()
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			if l.readDigits(10, false, fail) == 0 {
+				fail(exponent, "exponent has no digits")
+			}
+		}
+
+		if tokenType == token.INT && hasLeadingZero(l.text(start)) {
+			fail(start, "invalid leading zero in decimal literal, use 0o for octal")
+		}
+	}
+
+	// Letters right after the number belong to it, so 0xFG is one bad
+	// number and not 0xF followed by the identifier G
+	if isLetter(l.ch) || unicode.IsDigit(l.ch) {
+		if base == 10 {
+			fail(l.pos(), "identifier immediately after number")
+		} else {
+			fail(l.pos(), fmt.Sprintf("invalid digit %q in %s literal", l.ch, baseNames[base]))
+		}
+		for isLetter(l.ch) || unicode.IsDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	if numErr != nil {
+		l.errors = append(l.errors, *numErr)
+		return token.ILLEGAL
+	}
+
+	return tokenType
+}
+
+// baseNames are used in the error messages about number literals
+var baseNames = map[int]string{
+	2:  "binary",
+	8:  "octal",
+	10: "decimal",
+	16: "hexadecimal",
+}
+
+// readDigits reads the digits of a number in the given base and returns how
+// many digits it read. Decimal digits that don't belong to the base are
+// read as well and reported, so 0b102 is one bad number and not 0b10 and 2.
+// A '_' has to sit between two digits, or right after the base prefix when
+// afterPrefix is set
+func (l *Lexer) readDigits(base int, afterPrefix bool, fail func(token.Position, string)) int {
+	count := 0
+	sepAllowed := afterPrefix
+	lastSep := token.Position{}
+
+	for {
+		switch {
+		case l.ch == '_':
+			if !sepAllowed {
+				fail(l.pos(), "'_' must separate successive digits")
+			}
+			sepAllowed = false
+			lastSep = l.pos()
+		case isDigit(l.ch) || base == 16 && isHexDigit(l.ch):
+			if int(hexValue(l.ch)) >= base {
+				fail(l.pos(), fmt.Sprintf("invalid digit %q in %s literal", l.ch, baseNames[base]))
+			}
+			sepAllowed = true
+			lastSep = token.Position{}
+			count++
+		default:
+			// The number must not end with a '_'
+			if lastSep.IsValid() {
+				fail(lastSep, "'_' must separate successive digits")
+			}
+			return count
+		}
+
+		l.readChar()
+	}
+}
+
+// hasLeadingZero reports whether a decimal integer literal starts with a zero
+// that isn't the only digit, ex: 0755. Zeros alone like 00 are fine
+func hasLeadingZero(literal string) bool {
+	if len(literal) < 2 || literal[0] != '0' {
+		return false
+	}
+
+	return strings.Trim(literal, "0_") != ""
+}
+
+// readString reads a string literal. The current char is the opening quote
+// and when readString returns it's the closing quote (or eof if the string
+// is not terminated). It returns the value of the string and reports whether
+// the string was well formed. Strings can span multiple lines
+func (l *Lexer) readString() (string, bool) {
+	start := l.pos()
+	ok := true
+
+	var out strings.Builder
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == '"':
+			return out.String(), ok
+		case l.ch == eof:
+			l.error(start, "string literal not terminated")
+			return "", false
+		case l.ch == '\\':
+			if !l.readEscape(&out) {
+				ok = false
+			}
+		case l.invalidChar():
+			l.error(l.pos(), "invalid UTF-8 encoding in string literal")
+			ok = false
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
 }
 
-// readNumber is exactly same as the readIdentifier except it's use of isDigit
-// instead of isLetter
-func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+// readEscape reads an escape sequence inside a string literal and writes the
+// char it stands for to out. The current char is the backslash and when
+// readEscape returns it's the last char of the escape sequence.
+// The supported escape sequences are:
+//
+//	\n \t \r \" \\   newline, tab, carriage return, quote and backslash
+//	\u{XXXX}       the Unicode code point with 1 to 6 hexadecimal digits
+func (l *Lexer) readEscape(out *strings.Builder) bool {
+	start := l.pos()
+
+	// A backslash right before the end of the input is left for readString
+	// to report as an unterminated string
+	if l.peekChar() == eof {
+		return true
+	}
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		if l.peekChar() != '{' {
+			l.error(start, "missing { after \\u in escape sequence")
+			return false
+		}
+		l.readChar()
+
+		var value rune
+		digits := 0
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			value = value*16 + hexValue(l.ch)
+			digits++
+			// Stop growing the value once it's clearly too big, we still
+			// read the rest of the digits to report a single error
+			if value > unicode.MaxRune {
+				value = unicode.MaxRune + 1
+			}
+		}
+
+		if l.peekChar() != '}' {
+			l.error(start, "unterminated \\u{...} escape sequence")
+			return false
+		}
 		l.readChar()
+
+		if digits == 0 || digits > 6 {
+			l.error(start, "\\u{...} escape sequence must have 1 to 6 hexadecimal digits")
+			return false
+		}
+		if !utf8.ValidRune(value) {
+			l.error(start, fmt.Sprintf("escape sequence is not a valid Unicode code point: U+%X", value))
+			return false
+		}
+		out.WriteRune(value)
+	default:
+		l.error(start, fmt.Sprintf("unknown escape sequence \\%c", l.ch))
+		return false
 	}
 
-	return l.input[position:l.position]
+	return true
+}
+
+// Check if the character is a hexadecimal digit
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// hexValue returns the value of a hexadecimal digit
+func hexValue(ch rune) rune {
+	switch {
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	case 'A' <= ch && ch <= 'F':
+		return ch - 'A' + 10
+	default:
+		return ch - '0'
+	}
 }
 
-// Check if the current character is a digit
-func isDigit(ch byte) bool {
+// Check if the current character is a digit. Number literals are always
+// written with ASCII digits
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-// Skip whitespace when lexing as it does not have any meaning other than seperating tokens
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// Skip whitespace and comments when lexing as they do not have any meaning
+// other than seperating tokens. There are three kinds of comments:
+//
+//	# until the end of the line
+//	// until the end of the line
+//	/* until the matching */, block comments can be nested
+//
+// When trailing is set skipTrivia stops in front of a newline or a block
+// comment, it's used to read the trailing trivia of a token.
+// If a block comment isn't terminated skipTrivia returns false together with
+// the position where the comment started
+func (l *Lexer) skipTrivia(trailing bool) (token.Position, bool) {
+	for {
+		start := l.pos()
+
+		switch {
+		case isWhitespace(l.ch) && !(trailing && l.ch == '\n'):
+			for isWhitespace(l.ch) && !(trailing && l.ch == '\n') {
+				l.readChar()
+			}
+			l.addTrivia(token.WHITESPACE, start)
+		case l.ch == '#' || l.ch == '/' && l.peekChar() == '/':
+			for l.ch != '\n' && l.ch != eof {
+				l.readChar()
+			}
+			l.addTrivia(token.LINE_COMMENT, start)
+		case l.ch == '/' && l.peekChar() == '*' && !trailing:
+			ok := l.skipBlockComment()
+			l.addTrivia(token.BLOCK_COMMENT, start)
+			if !ok {
+				return start, false
+			}
+		default:
+			return start, true
+		}
+	}
+}
+
+// skipBlockComment skips a block comment, the current char being the / of
+// the opening /*. Every /* inside the comment has to be closed by its own */
+// It reports whether the comment was terminated
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+	for {
+		switch {
+		case l.ch == eof:
+			return false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return true
+			}
+		}
 		l.readChar()
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+// addTrivia records the source between start and the current char as trivia,
+// if the lexer keeps trivia at all
+func (l *Lexer) addTrivia(kind token.TriviaKind, start token.Position) {
+	if !l.keepTrivia {
+		return
+	}
+
+	l.trivia = append(l.trivia, token.Trivia{
+		Kind:  kind,
+		Text:  l.text(start),
+		Start: start,
+		End:   l.pos(),
+	})
+}
+
+// Check if the character is whitespace
+func isWhitespace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+// peekChar decodes the char after the current one without advancing
+func (l *Lexer) peekChar() rune {
+	if l.reader != nil {
+		return l.peekRune()
+	}
+
 	if l.readPosition >= len(l.input) {
-		return 0
+		return eof
 	}
 
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
 }
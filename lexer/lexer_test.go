@@ -1,8 +1,15 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/thewebdevel/monkey-interpreter/internal/corpus"
 	"github.com/thewebdevel/monkey-interpreter/token"
 )
 
@@ -77,3 +84,735 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestNextTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x != y\n"
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, pos(0, 1, 1), pos(3, 1, 4)},
+		{token.IDENT, pos(4, 1, 5), pos(5, 1, 6)},
+		{token.ASSIGN, pos(6, 1, 7), pos(7, 1, 8)},
+		{token.INT, pos(8, 1, 9), pos(10, 1, 11)},
+		{token.SEMICOLON, pos(10, 1, 11), pos(11, 1, 12)},
+		{token.IDENT, pos(14, 2, 3), pos(15, 2, 4)},
+		{token.NOT_EQ, pos(16, 2, 5), pos(18, 2, 7)},
+		{token.IDENT, pos(19, 2, 8), pos(20, 2, 9)},
+		{token.EOF, pos(21, 3, 1), pos(21, 3, 1)},
+		{token.EOF, pos(21, 3, 1), pos(21, 3, 1)},
+	}
+
+	l := New(input, WithFilename("main.mk"))
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Start != tt.expectedStart {
+			t.Fatalf("tests[%d] - start wrong. expected=%+v, got=%+v", i, tt.expectedStart, tok.Start)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Fatalf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.End)
+		}
+
+		if input[tok.Start.Offset:tok.End.Offset] != tok.Literal {
+			t.Fatalf("tests[%d] - source text wrong. expected=%q, got=%q", i, tok.Literal, input[tok.Start.Offset:tok.End.Offset])
+		}
+	}
+}
+
+// pos builds a token.Position in the "main.mk" test file
+func pos(offset, line, column int) token.Position {
+	return token.Position{Filename: "main.mk", Offset: offset, Line: line, Column: column}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := "let café = π1 + 名前;\n日本 \xff @"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "café", 5},
+		{token.ASSIGN, "=", 10},
+		{token.IDENT, "π1", 12},
+		{token.PLUS, "+", 15},
+		{token.IDENT, "名前", 17},
+		{token.SEMICOLON, ";", 19},
+		{token.IDENT, "日本", 1},
+		{token.ILLEGAL, "\xff", 4},
+		{token.ILLEGAL, "@", 6},
+		{token.EOF, "", 7},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Start.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Start.Column)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("lexer has wrong number of errors. expected=2, got=%d", len(errors))
+	}
+
+	if errors[0].Error() != "2:4: invalid UTF-8 encoding (byte 0xff)" {
+		t.Errorf("errors[0] wrong. got=%q", errors[0].Error())
+	}
+
+	if errors[1].Error() != "2:6: unexpected character '@'" {
+		t.Errorf("errors[1] wrong. got=%q", errors[1].Error())
+	}
+}
+
+func TestNextTokenStrings(t *testing.T) {
+	input := `"foobar" "foo bar" "a\tb\n" "say \"hi\"" "C:\\dir" "\u{48}\u{1F600}" ""`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "a\tb\n"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `C:\dir`},
+		{token.STRING, "H😀"},
+		{token.STRING, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("lexer has unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestNextTokenStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"abc`, `"abc`, "1:1: string literal not terminated"},
+		{`"abc\`, `"abc\`, "1:1: string literal not terminated"},
+		{`"a\qb"`, `"a\qb"`, `1:3: unknown escape sequence \q`},
+		{`"\u41"`, `"\u41"`, `1:2: missing { after \u in escape sequence`},
+		{`"\u{41"`, `"\u{41"`, `1:2: unterminated \u{...} escape sequence`},
+		{`"\u{}"`, `"\u{}"`, `1:2: \u{...} escape sequence must have 1 to 6 hexadecimal digits`},
+		{`"\u{D800}"`, `"\u{D800}"`, "1:2: escape sequence is not a valid Unicode code point: U+D800"},
+		{`"\u{110000}"`, `"\u{110000}"`, "1:2: escape sequence is not a valid Unicode code point: U+110000"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.ILLEGAL, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after the string. got=%q", i, next.Type)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("tests[%d] - wrong number of errors. got=%v", i, errors)
+		}
+
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("tests[%d] - error wrong. expected=%q, got=%q", i, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `# a line comment
+		let x = 5; // the answer
+		/* a block /* nested */ comment */ x / 2
+		`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.LeadingTrivia != nil || tok.TrailingTrivia != nil {
+			t.Fatalf("tests[%d] - unexpected trivia. got=%+v %+v", i, tok.LeadingTrivia, tok.TrailingTrivia)
+		}
+	}
+}
+
+func TestNextTokenUnterminatedComment(t *testing.T) {
+	input := "x /* a /* b */"
+
+	l := New(input)
+
+	if tok := l.NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.IDENT, tok.Type)
+	}
+
+	// The token spans the rest of the input, only the /* is its literal
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/*" {
+		t.Fatalf("token wrong. expected ILLEGAL %q, got=%q %q", "/*", tok.Type, tok.Literal)
+	}
+	if tok.Start.Offset != 2 || tok.End.Offset != len(input) {
+		t.Fatalf("token span wrong. got=%d-%d", tok.Start.Offset, tok.End.Offset)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Error() != "1:3: comment not terminated" {
+		t.Fatalf("errors wrong. got=%v", errors)
+	}
+}
+
+func TestNextTokenTrivia(t *testing.T) {
+	input := "# header\nlet x = 5; // five\n\n/* doc */ x\t# end\n"
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLeading  []string
+		expectedTrailing []string
+	}{
+		{token.LET, []string{"# header", "\n"}, []string{" "}},
+		{token.IDENT, nil, []string{" "}},
+		{token.ASSIGN, nil, []string{" "}},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, []string{" ", "// five"}},
+		{token.IDENT, []string{"\n\n", "/* doc */", " "}, []string{"\t", "# end"}},
+		{token.EOF, []string{"\n"}, nil},
+	}
+
+	l := New(input, WithTrivia())
+
+	var out strings.Builder
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if got := triviaTexts(tok.LeadingTrivia); !reflect.DeepEqual(got, tt.expectedLeading) {
+			t.Fatalf("tests[%d] - leading trivia wrong. expected=%q, got=%q", i, tt.expectedLeading, got)
+		}
+
+		if got := triviaTexts(tok.TrailingTrivia); !reflect.DeepEqual(got, tt.expectedTrailing) {
+			t.Fatalf("tests[%d] - trailing trivia wrong. expected=%q, got=%q", i, tt.expectedTrailing, got)
+		}
+
+		for _, tr := range tok.LeadingTrivia {
+			out.WriteString(tr.Text)
+		}
+		out.WriteString(input[tok.Start.Offset:tok.End.Offset])
+		for _, tr := range tok.TrailingTrivia {
+			out.WriteString(tr.Text)
+		}
+	}
+
+	if out.String() != input {
+		t.Errorf("input not round-tripped. expected=%q, got=%q", input, out.String())
+	}
+}
+
+// triviaTexts returns the text of every piece of trivia
+func triviaTexts(trivia []token.Trivia) []string {
+	var texts []string
+	for _, tr := range trivia {
+		texts = append(texts, tr.Text)
+	}
+
+	return texts
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := `0 42 1_000 0x1F 0XdeadBEEF 0o17 0b1010 0x_FF 3.14 1e10 2.5E-3 1_0.0_1e+1_0 0.5 00`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0"},
+		{token.INT, "42"},
+		{token.INT, "1_000"},
+		{token.INT, "0x1F"},
+		{token.INT, "0XdeadBEEF"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1010"},
+		{token.INT, "0x_FF"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "1_0.0_1e+1_0"},
+		{token.FLOAT, "0.5"},
+		{token.INT, "00"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("lexer has unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestNextTokenNumberErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0x", "0x", "1:1: hexadecimal literal has no digits"},
+		{"0b", "0b", "1:1: binary literal has no digits"},
+		{"0o_", "0o_", "1:3: '_' must separate successive digits"},
+		{"1e", "1e", "1:2: exponent has no digits"},
+		{"1.5e+", "1.5e+", "1:4: exponent has no digits"},
+		{"0b102", "0b102", "1:5: invalid digit '2' in binary literal"},
+		{"0o78", "0o78", "1:4: invalid digit '8' in octal literal"},
+		{"1__000", "1__000", "1:3: '_' must separate successive digits"},
+		{"1000_", "1000_", "1:5: '_' must separate successive digits"},
+		{"1_.5", "1_.5", "1:2: '_' must separate successive digits"},
+		{"0755", "0755", "1:1: invalid leading zero in decimal literal, use 0o for octal"},
+		{"0xFG", "0xFG", "1:4: invalid digit 'G' in hexadecimal literal"},
+		{"0b1z", "0b1z", "1:4: invalid digit 'z' in binary literal"},
+		{"12abc", "12abc", "1:3: identifier immediately after number"},
+		{"1.5e3x", "1.5e3x", "1:6: identifier immediately after number"},
+		{"1_000ü2", "1_000ü2", "1:6: identifier immediately after number"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.ILLEGAL, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after the number. got=%q", i, next.Type)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("tests[%d] - wrong number of errors. got=%v", i, errors)
+		}
+
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("tests[%d] - error wrong. expected=%q, got=%q", i, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestNewReaderMatchesNew(t *testing.T) {
+	inputs := []string{
+		"",
+		"let five = 5;\nlet add = fn(x, y) { x + y; };\n",
+		"let café = π1 + 名前;\n日本 \xff @ \xe6\x97",
+		`"foo" "a\tb\n" "\u{1F600}" "bad \q" "abc`,
+		"# header\nlet x = 5; // five\n\n/* a /* nested */ doc */ x\t# end\n",
+		"x /* not terminated",
+		"0x1F 1_000 3.14 1e 0b102 0755",
+	}
+
+	for i, input := range inputs {
+		for _, opts := range [][]Option{nil, {WithTrivia(), WithFilename("main.mk")}} {
+			expected := New(input, opts...)
+			// Reading one byte at a time makes sure runes split between two
+			// reads are put back together correctly
+			actual := NewReader(iotest.OneByteReader(strings.NewReader(input)), opts...)
+
+			for {
+				want, got := expected.NextToken(), actual.NextToken()
+				if !reflect.DeepEqual(want, got) {
+					t.Fatalf("inputs[%d] - token wrong.\nexpected=%+v\ngot=%+v", i, want, got)
+				}
+
+				if want.Type == token.EOF {
+					break
+				}
+			}
+
+			if !reflect.DeepEqual(expected.Errors(), actual.Errors()) {
+				t.Fatalf("inputs[%d] - errors wrong. expected=%v, got=%v", i, expected.Errors(), actual.Errors())
+			}
+		}
+	}
+}
+
+func TestNewReaderBoundedBuffering(t *testing.T) {
+	input := strings.Repeat("let x = 10 + y; # a comment\n", 50000)
+
+	l := NewReader(strings.NewReader(input), WithTrivia())
+
+	count := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		count++
+	}
+
+	if count != 7*50000 {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d", 7*50000, count)
+	}
+
+	// Only the text of a single token and its trivia is ever kept around
+	if cap(l.window) > 1024 {
+		t.Errorf("window grew with the input. got cap=%d", cap(l.window))
+	}
+
+	// Without trivia not even a huge comment is kept
+	comment := strings.Repeat("comment ", 1<<20)
+	for _, input := range []string{
+		"x /* " + comment + "*/ y",
+		"x # " + comment + "\ny",
+		"x /* " + comment,
+	} {
+		l := NewReader(strings.NewReader(input))
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		if cap(l.window) > 1024 {
+			t.Errorf("window grew with a comment. got cap=%d", cap(l.window))
+		}
+	}
+}
+
+// A Lexer reading from a pipe hands out every token that's complete, even
+// when the writer stops in the middle of the program
+func TestNewReaderStalledPipe(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	go w.Write([]byte("let x = 5;\nlet é"))
+
+	tokens := make(chan token.TokenType, 10)
+	go func() {
+		l := NewReader(r)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			tokens <- tok.Type
+		}
+		close(tokens)
+	}()
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.LET}
+	for _, tt := range expected {
+		select {
+		case got := <-tokens:
+			if got != tt {
+				t.Fatalf("tokentype wrong. expected=%q, got=%q", tt, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("lexer blocked before handing out %q", tt)
+		}
+	}
+}
+
+func TestNewReaderReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("broken pipe")))
+
+	l := NewReader(r)
+
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.ILLEGAL, token.EOF, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Error() != "1:6: read error: broken pipe" {
+		t.Fatalf("errors wrong. got=%v", errors)
+	}
+}
+
+func TestNextTokenOperators(t *testing.T) {
+	input := `= + - ! / * % ** && || << >> -> |> += -= *= /= %= == != < > <= >= , ; : ( ) { } [ ]
+		a**-b x<=-1 f|>g !!= ***= & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.ASSIGN, "="},
+		{token.PLUS, "+"},
+		{token.MINUS, "-"},
+		{token.BANG, "!"},
+		{token.SLASH, "/"},
+		{token.ASTERISK, "*"},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.SHL, "<<"},
+		{token.SHR, ">>"},
+		{token.ARROW, "->"},
+		{token.PIPE, "|>"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.EQ, "=="},
+		{token.NOT_EQ, "!="},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.COMMA, ","},
+		{token.SEMICOLON, ";"},
+		{token.COLON, ":"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "a"},
+		{token.POWER, "**"},
+		{token.MINUS, "-"},
+		{token.IDENT, "b"},
+		{token.IDENT, "x"},
+		{token.LT_EQ, "<="},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.IDENT, "f"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "g"},
+		{token.BANG, "!"},
+		{token.NOT_EQ, "!="},
+		{token.POWER, "**"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func BenchmarkNextToken(b *testing.B) {
+	input := corpus.Benchmark()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func TestNextTokenKeywords(t *testing.T) {
+	input := "fn let return true false if else while for break continue null iffy"
+
+	tests := []token.TokenType{
+		token.FUNCTION, token.LET, token.RETURN, token.TRUE, token.FALSE, token.IF, token.ELSE,
+		token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.NULL, token.IDENT, token.EOF,
+	}
+
+	l := New(input)
+
+	for i, expected := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestNextTokenCustomOperatorsAndKeywords(t *testing.T) {
+	rng := token.Register("..")
+	fatArrow := token.Register("=>")
+	in := token.Register("IN")
+
+	input := "1..10 x=>y x in xs a.b inside == ="
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1"},
+		{rng, ".."},
+		{token.INT, "10"},
+		{token.IDENT, "x"},
+		{fatArrow, "=>"},
+		{token.IDENT, "y"},
+		{token.IDENT, "x"},
+		{in, "in"},
+		{token.IDENT, "xs"},
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "b"},
+		{token.IDENT, "inside"},
+		{token.EQ, "=="},
+		{token.ASSIGN, "="},
+		{token.EOF, ""},
+	}
+
+	l := New(input, WithOperator("..", rng), WithOperator("=>", fatArrow), WithKeyword("in", in))
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Msg != `unknown operator "."` {
+		t.Errorf("wrong errors. got=%v", errors)
+	}
+}
+
+// FuzzNextToken feeds the lexer random input. Whatever the input is, the
+// lexer must not panic and must reach EOF, the tokens must follow each other
+// in the input and every token.ILLEGAL must come with an error. A lexer
+// reading from an io.Reader must see the same tokens as one reading from
+// a string. New seeds go into testdata/fuzz/FuzzNextToken
+func FuzzNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5;\nlet add = fn(x, y) { x + y; };",
+		"a**-b x<=-1 f|>g !!= ***= & |",
+		`"foo" "a\tb\n" "\u{1F600}" "bad \q" "abc`,
+		"# header\n/* a /* nested */ doc */ x // end",
+		"0x1F 1_000 3.14 1e 0b102 0755 0x_1",
+		"let café = π1 + 名前;\xff @ \xe6\x97",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input, WithTrivia())
+		r := NewReader(iotest.OneByteReader(strings.NewReader(input)), WithTrivia())
+
+		end, illegal := 0, 0
+		for i := 0; ; i++ {
+			tok := l.NextToken()
+			if fromReader := r.NextToken(); !reflect.DeepEqual(tok, fromReader) {
+				t.Fatalf("NewReader token wrong.\nexpected=%+v\ngot=%+v", tok, fromReader)
+			}
+
+			if tok.Start.Offset < end || tok.End.Offset < tok.Start.Offset || tok.End.Offset > len(input) {
+				t.Fatalf("token %+v out of place, previous token ended at %d", tok, end)
+			}
+			end = tok.End.Offset
+
+			switch tok.Type {
+			case token.ILLEGAL:
+				illegal++
+			case token.STRING:
+			default:
+				if text := input[tok.Start.Offset:tok.End.Offset]; text != tok.Literal {
+					t.Fatalf("literal %q doesn't match source text %q", tok.Literal, text)
+				}
+			}
+
+			if tok.Type == token.EOF {
+				break
+			}
+			if i > len(input) {
+				t.Fatalf("lexer doesn't reach EOF")
+			}
+		}
+
+		if len(l.Errors()) < illegal {
+			t.Fatalf("%d ILLEGAL tokens but only %d errors", illegal, len(l.Errors()))
+		}
+		if !reflect.DeepEqual(l.Errors(), r.Errors()) {
+			t.Fatalf("NewReader errors wrong. expected=%v, got=%v", l.Errors(), r.Errors())
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package lexer
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// NewReader returns a Lexer that reads its input from r, a few bytes at a
+// time, instead of holding the whole program in memory. This is handy for
+// big generated scripts or for input coming from a pipe.
+//
+// The Lexer only keeps the buffer of a bufio.Reader and the text of the
+// token it's working on, so memory use doesn't grow with the size of the
+// input. With WithTrivia the text of the comments in front of the token is
+// kept too, without it even a huge comment is skipped a rune at a time.
+// Apart from that it behaves exactly like a Lexer created with New,
+// the tokens, their positions, trivia and errors are all the same
+//
+// If reading from r fails with an error other than io.EOF, the error is
+// recorded like any other lexer error and the input ends right there. The
+// Lexer hands out a token.ILLEGAL for it, in front of the token.EOF
+func NewReader(r io.Reader, opts ...Option) *Lexer {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	l := &Lexer{reader: br, line: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.readChar()
+	return l
+}
+
+// readRune is readChar for a Lexer reading from an io.Reader. It sets ch
+// and width to the next char of the reader
+func (l *Lexer) readRune() {
+	// Keep the bytes of the char we move past, the token that's being
+	// read may need its text
+	if !l.discard {
+		l.window = append(l.window, l.chBytes[:l.width]...)
+	}
+
+	// Peek at the bytes of the next rune before consuming them, this way we
+	// know the raw bytes even when they aren't valid UTF-8
+	b := l.peekBytes()
+	if len(b) == 0 {
+		l.ch, l.width = eof, 0
+		return
+	}
+
+	l.ch, l.width = utf8.DecodeRune(b)
+	copy(l.chBytes[:], b[:l.width])
+	l.reader.Discard(l.width)
+}
+
+// peekRune is peekChar for a Lexer reading from an io.Reader
+func (l *Lexer) peekRune() rune {
+	b := l.peekBytes()
+	if len(b) == 0 {
+		return eof
+	}
+
+	r, _ := utf8.DecodeRune(b)
+	return r
+}
+
+// peekBytes returns the bytes of the next rune without consuming them, or
+// nothing at the end of the input. It only waits for as many bytes as the
+// rune has, a pipe that stalls after a complete rune doesn't block it
+func (l *Lexer) peekBytes() []byte {
+	b, err := l.reader.Peek(1)
+	for n := 2; len(b) == n-1 && !utf8.FullRune(b) && n <= utf8.UTFMax; n++ {
+		b, err = l.reader.Peek(n)
+	}
+	if len(b) == 0 || !utf8.FullRune(b) {
+		l.setReadError(err)
+	}
+	return b
+}
+
+// setReadError remembers the first error of the reader, readChar reports it
+// once the input ends. bufio.Reader hands out an error only once, so it has to
+// be kept no matter if it comes from a read or a peek
+func (l *Lexer) setReadError(err error) {
+	if err != nil && err != io.EOF && l.readErr == nil {
+		l.readErr = err
+	}
+}
@@ -9,6 +9,11 @@ import (
 )
 
 func main() {
+	// monkey <command> runs one of the commands, just monkey starts the REPL
+	if len(os.Args) > 1 {
+		os.Exit(run(os.Args[1], os.Args[2:]))
+	}
+
 	user, err := user.Current()
 
 	if err != nil {
@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+// ErrorCode tells what kind of problem a ParseError is about, so tools can
+// react to an error without looking at its message
+type ErrorCode int
+
+const (
+	// ErrUnexpectedToken is reported when a token is not the one the grammar
+	// asks for, ex: let 5 = x; where an identifier is expected after let
+	ErrUnexpectedToken ErrorCode = iota + 1
+	// ErrNoPrefixParseFn is reported when a token can't start an expression
+	ErrNoPrefixParseFn
+	// ErrMissingExpression is reported when a statement ends where an
+	// expression is expected, ex: let x = ;
+	ErrMissingExpression
+	// ErrIllegalToken is reported for every error the lexer found in a
+	// token.ILLEGAL token
+	ErrIllegalToken
+	// ErrInvalidNumber is reported when a number literal doesn't fit into
+	// its type
+	ErrInvalidNumber
+	// ErrBranchOutsideLoop is reported for break and continue outside of
+	// a loop
+	ErrBranchOutsideLoop
+	// ErrNestingTooDeep is reported when statements and expressions are
+	// nested deeper than the parser allows, see WithMaxDepth
+	ErrNestingTooDeep
+)
+
+var errorCodeNames = [...]string{
+	ErrUnexpectedToken:   "unexpected token",
+	ErrNoPrefixParseFn:   "no prefix parse function",
+	ErrMissingExpression: "missing expression",
+	ErrIllegalToken:      "illegal token",
+	ErrInvalidNumber:     "invalid number",
+	ErrBranchOutsideLoop: "branch outside of loop",
+	ErrNestingTooDeep:    "nesting too deep",
+}
+
+func (c ErrorCode) String() string {
+	if c > 0 && int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return "unknown error"
+}
+
+// ParseError describes a single problem the parser found in its input.
+// Start and End span the part of the input the error is about, most of the
+// time that's the offending Token. Expected lists the token types that
+// would have been fine instead, where an expression was missing those are
+// all the types an expression can start with
+type ParseError struct {
+	Code     ErrorCode
+	Msg      string
+	Start    token.Position
+	End      token.Position
+	Token    token.Token
+	Expected []token.TokenType
+}
+
+// Error renders the error as "line:column: message", or as just the message
+// when the position is unknown
+func (e *ParseError) Error() string {
+	if !e.Start.IsValid() {
+		return e.Msg
+	}
+	return e.Start.String() + ": " + e.Msg
+}
+
+// AddError records a ParseError about the token tok. Parse functions added
+// with the options of New use it to report their errors. An error with
+// one of the syntax codes, like ErrUnexpectedToken, makes the parser skip the
+// statement it is in
+func (p *Parser) AddError(code ErrorCode, tok token.Token, msg string, expected ...token.TokenType) {
+	p.report(&ParseError{
+		Code:     code,
+		Msg:      msg,
+		Start:    tok.Start,
+		End:      tok.End,
+		Token:    tok,
+		Expected: expected,
+	})
+}
+
+// report records err, unless the parser is still recovering from a syntax
+// error. A syntax error puts the parser into panic mode, the other errors
+// are about a value and the parser carries on like nothing happened
+func (p *Parser) report(err *ParseError) {
+	if p.panicking {
+		return
+	}
+
+	// A second error at the same place adds nothing new, this happens when
+	// several blocks are still open at the end of the input
+	if n := len(p.errors); n == 0 || p.errors[n-1].Start != err.Start {
+		p.errors = append(p.errors, err)
+		if p.traceOut != nil {
+			p.printTrace("error: %s", err.Msg)
+		}
+	}
+
+	switch err.Code {
+	case ErrUnexpectedToken, ErrNoPrefixParseFn, ErrMissingExpression, ErrNestingTooDeep:
+		p.panicking = true
+	}
+}
+
+// syncTokens are the tokens a statement can start with and nothing else can,
+// except for if. Skipping a broken statement stops in front of them
+var syncTokens = [token.NumTokenTypes]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.IF:       true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
+// recoverStatement gets the parser out of panic mode after a syntax error
+// in the statement that began with start, base is the nesting of braces
+// around the statement. It skips the rest of the statement and returns an
+// *ast.BadStatement that stands in for all of it
+func (p *Parser) recoverStatement(start token.Token, base int) ast.Statement {
+	// A } that was found where an expression should be and that closes the
+	// block we are in, like in { x + }, is left to parseBlockStatement. We
+	// move back to the token before it. The statement must keep at least
+	// one token, or we would parse it again and again
+	if p.blockDepth > 0 && p.curTokenIs(token.RBRACE) && p.nesting < base &&
+		p.curToken.Start.Offset > start.Start.Offset &&
+		p.errors[len(p.errors)-1].Start == p.curToken.Start {
+		p.backup()
+	}
+
+	p.synchronize(base)
+	p.panicking = false
+	if p.traceOut != nil {
+		p.printTrace("skipped to %s", traceToken(p.curToken))
+	}
+
+	return &ast.BadStatement{Token: start, End: p.curToken.End}
+}
+
+// synchronize skips tokens until p.curToken is the last token of the broken
+// statement. That's the case on a semicolon, or in front of a token that
+// starts a statement, a } or the end of the input. Only the tokens outside of
+// the braces the statement opened count, when the nesting is back at base.
+// Parentheses and square brackets don't count, they are often left open by
+// the error itself, like in let x = (1 + 2;
+func (p *Parser) synchronize(base int) {
+	for {
+		if p.nesting <= base && p.curTokenIs(token.SEMICOLON) {
+			return
+		}
+		if p.peekTokenIs(token.EOF) {
+			return
+		}
+		if p.nesting <= base && (p.peekTokenIs(token.RBRACE) || p.startsStatement(p.peekToken.Type)) {
+			return
+		}
+
+		p.nextToken()
+	}
+}
+
+// startsStatement reports whether t is a token a statement starts with,
+// including the statements added with WithStatement
+func (p *Parser) startsStatement(t token.TokenType) bool {
+	return syncTokens[t] || p.statementParseFns[t] != nil
+}
+
+// nesting tells how a token changes the nesting of braces
+func nesting(t token.TokenType) int {
+	switch t {
+	case token.LBRACE:
+		return 1
+	case token.RBRACE:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+// The parser can be extended with new operators and statements, for a DSL
+// that's built on top of Monkey. The new tokens are made with
+// token.Register and the lexer learns them with lexer.WithOperator and
+// lexer.WithKeyword. Then the options below tell the parser what to do with
+// them:
+//
+//	rng := token.Register("..")
+//	l := lexer.New(input, lexer.WithOperator("..", rng))
+//	p := parser.New(l, parser.WithInfixOperator(rng, parser.LESSGREATER))
+//
+// A parse function added with an option works like the built in ones. It's
+// called with CurToken on its token and has to leave the parser on the last
+// token of what it parsed. It builds its result from the nodes of package
+// ast and reports errors with AddError
+
+// PrefixParseFn parses an expression that starts with the token it was
+// added for
+type PrefixParseFn func(p *Parser) ast.Expression
+
+// InfixParseFn parses an expression where the token it was added for comes
+// after the expression left
+type InfixParseFn func(p *Parser, left ast.Expression) ast.Expression
+
+// StatementParseFn parses a statement that starts with the keyword it was
+// added for. When it fails it returns nil, not a nil pointer of a node type
+type StatementParseFn func(p *Parser) ast.Statement
+
+// Option configures a Parser. Options are passed to New after the lexer
+type Option func(*Parser)
+
+// WithPrefix makes fn the parse function of t in prefix position
+func WithPrefix(t token.TokenType, fn PrefixParseFn) Option {
+	return func(p *Parser) {
+		p.registerPrefix(t, func() ast.Expression { return fn(p) })
+	}
+}
+
+// WithInfix makes fn the parse function of t in infix position. The
+// precedence decides how tightly t binds, it has to be above LOWEST.
+// It's one of the precedence constants, ex: SUM for an operator that binds
+// like +. WithInfix panics when the precedence is too low, the parser would
+// never get to t
+func WithInfix(t token.TokenType, precedence int, fn InfixParseFn) Option {
+	checkPrecedence(t, precedence)
+	return func(p *Parser) {
+		p.precedences[t] = precedence
+		p.registerInfix(t, func(left ast.Expression) ast.Expression { return fn(p, left) })
+	}
+}
+
+// WithPrefixOperator makes t a prefix operator like ! or -, it's parsed
+// into an *ast.PrefixExpression
+func WithPrefixOperator(t token.TokenType) Option {
+	return func(p *Parser) {
+		p.registerPrefix(t, p.parsePrefixExpression)
+	}
+}
+
+// WithInfixOperator makes t a binary operator like + or ==, it's parsed
+// into an *ast.InfixExpression. See WithInfix for the precedence
+func WithInfixOperator(t token.TokenType, precedence int) Option {
+	checkPrecedence(t, precedence)
+	return func(p *Parser) {
+		p.precedences[t] = precedence
+		p.registerInfix(t, p.parseInfixExpression)
+	}
+}
+
+// checkPrecedence panics if an infix operator t with the precedence can't
+// ever be parsed. parseExpression only looks at the operators that bind
+// tighter than LOWEST
+func checkPrecedence(t token.TokenType, precedence int) {
+	if precedence <= LOWEST {
+		panic(fmt.Sprintf("parser: precedence %d of %s must be above LOWEST", precedence, t))
+	}
+}
+
+// WithRightAssociative makes the infix operator t group from the right,
+// a op b op c is then a op (b op c). It applies to the operators parsed into
+// an *ast.InfixExpression, an InfixParseFn takes care of this itself
+func WithRightAssociative(t token.TokenType) Option {
+	return func(p *Parser) {
+		p.rightAssociative[t] = true
+	}
+}
+
+// WithStatement makes fn the parse function of the statements that start
+// with the keyword t. The built in statements can't be replaced
+func WithStatement(t token.TokenType, fn StatementParseFn) Option {
+	return func(p *Parser) {
+		p.statementParseFns[t] = fn
+	}
+}
+
+// CurToken returns the token the parser is on
+func (p *Parser) CurToken() token.Token { return p.curToken }
+
+// PeekToken returns the token after CurToken
+func (p *Parser) PeekToken() token.Token { return p.peekToken }
+
+// NextToken moves the parser on to the next token
+func (p *Parser) NextToken() { p.nextToken() }
+
+// ExpectPeek moves on to the next token if it's of type t. If it isn't, it
+// reports an error and returns false
+func (p *Parser) ExpectPeek(t token.TokenType) bool { return p.expectPeek(t) }
+
+// ParseExpression parses the expression that starts with CurToken. Only the
+// operators that bind tighter than precedence are part of it
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
+
+// ParseBlockStatement parses a block, CurToken has to be its {
+func (p *Parser) ParseBlockStatement() *ast.BlockStatement {
+	return p.parseBlockStatement()
+}
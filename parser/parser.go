@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 
 	"github.com/thewebdevel/monkey-interpreter/ast"
 	"github.com/thewebdevel/monkey-interpreter/lexer"
@@ -11,17 +14,25 @@ import (
 
 // We use iota to give the following constants incremental numbers as values
 // The blank identifier _ takes the zero value and the following constants
-// get assinged from 1 to 7. These constants are used to check "does the * operator
+// get assinged from 1 upwards. These constants are used to check "does the * operator
 // has higher precedence than =="
 const (
 	_ int = iota
 	LOWEST
-	EQUALS      // == LESSGREATER // > or <
-	LESSGREATER // < or >
+	ASSIGN      // x += y
+	ARROW       // x -> y
+	PIPE        // x |> f
+	OR          // ||
+	AND         // &&
+	EQUALS      // == or !=
+	LESSGREATER // <, >, <= or >=
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // x ** y
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 // precedences is our precedence table. It associates token type with its
@@ -31,16 +42,65 @@ const (
 // The table can now tell us that + (token.PLUS) and - (token.MINUS) have the
 // same precedence which is lover than the precedence of * (token.ASTERISK) and
 // / (token.SLASH)
-var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
+//
+// ** binds tighter than a prefix operator, so -2 ** 2 is -(2 ** 2)
+//
+// The table is an array indexed by token type, token types that aren't
+// listed have a precedence of 0
+var precedences = [token.NumTokenTypes]int{
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.ARROW:           ARROW,
+	token.PIPE:            PIPE,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.SHL:             SHIFT,
+	token.SHR:             SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+}
+
+// rightAssociative lists the infix operators that group from the right,
+// a ** b ** c is a ** (b ** c) while a - b - c is (a - b) - c
+var rightAssociative = [token.NumTokenTypes]bool{
+	token.PLUS_ASSIGN:     true,
+	token.MINUS_ASSIGN:    true,
+	token.ASTERISK_ASSIGN: true,
+	token.SLASH_ASSIGN:    true,
+	token.PERCENT_ASSIGN:  true,
+	token.ARROW:           true,
+	token.POWER:           true,
+}
+
+// Precedence returns the precedence of the built in infix operator t, or
+// LOWEST if t isn't one. A tool that prints expressions needs it to know
+// where parentheses have to go
+func Precedence(t token.TokenType) int {
+	if p := precedences[t]; p != 0 {
+		return p
+	}
+	return LOWEST
+}
+
+// RightAssociative reports whether the built in infix operator t groups
+// from the right
+func RightAssociative(t token.TokenType) bool {
+	return rightAssociative[t]
 }
 
 // We defined two types of function
@@ -66,8 +126,11 @@ type (
 // they point to the next TOKEN.
 type Parser struct {
 	l *lexer.Lexer
-	// An error field which is a slice of strings
-	errors []string
+	// The errors found so far, in the order they were found
+	errors []*ParseError
+	// lexErr is the first lexer error that may still belong to a
+	// token.ILLEGAL, the ones in front of it come before curToken
+	lexErr int
 
 	// We need to look at the curToken, which is the current token under examination
 	// to decide what to do next, we also need peekToken for the decision if
@@ -78,17 +141,55 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	// With these maps, we can check if the appropriate map(infix or prefix)
-	// has a parsing function associated with currToken.Type
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
+	// prevToken is the token before curToken, backup uses it to move the
+	// parser back by one token. The token it pushes out of peekToken waits
+	// in backupToken until nextToken needs it again
+	prevToken   token.Token
+	backupToken token.Token
+	backedUp    bool
+
+	// With these tables, we can check if the appropriate table(infix or prefix)
+	// has a parsing function associated with currToken.Type. They are arrays
+	// indexed by token type, a missing function is nil
+	prefixParseFns [token.NumTokenTypes]prefixParseFn
+	infixParseFns  [token.NumTokenTypes]infixParseFn
+
+	// The precedence and associativity of the infix operators, they start
+	// out as a copy of the tables above. statementParseFns holds the
+	// statements added with WithStatement
+	precedences       [token.NumTokenTypes]int
+	rightAssociative  [token.NumTokenTypes]bool
+	statementParseFns [token.NumTokenTypes]StatementParseFn
+
+	// loopDepth counts the loops we are in, break and continue are only
+	// allowed inside of a loop
+	loopDepth int
+
+	// depth counts how deep the statements and expressions that are being
+	// parsed are nested, it can't go above maxDepth
+	depth    int
+	maxDepth int
+
+	// blockDepth counts the blocks we are in and nesting counts the
+	// braces that are open up to and including curToken
+	blockDepth int
+	nesting    int
+
+	// Where WithTrace writes to and the indentation of the trace
+	traceOut   io.Writer
+	traceDepth int
+
+	// panicking is set by a syntax error. Until the statement with the error
+	// is skipped, no more errors are reported, they would only be noise
+	// caused by the first one
+	panicking bool
 }
 
 // peekPrecedence method returns the precedence associated with the token type
 // of p.peekToken. If it doesn't find a precedence for p.peekToken it defaults
 // to LOWEST, the lowest precedence any operator can have.
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+	if p := p.precedences[p.peekToken.Type]; p != 0 {
 		return p
 	}
 
@@ -99,30 +200,61 @@ func (p *Parser) peekPrecedence() int {
 // of p.curToken. If it doesn't find a precedence for p.curToken it defaults
 // to LOWEST, the lowest precedence any operator can have.
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	if p := p.precedences[p.curToken.Type]; p != 0 {
 		return p
 	}
 
 	return LOWEST
 }
 
+// DefaultMaxDepth is how deep statements and expressions can be nested
+// unless WithMaxDepth says otherwise. Brackets, prefix operators, blocks
+// and every operator of a chain like a + b + c each add a level, so it's
+// far more than any program written by hand needs
+const DefaultMaxDepth = 10000
+
+// WithMaxDepth limits how deep statements and expressions can be nested.
+// The parser calls itself for every level, so the limit keeps input like a
+// million ( from using up the stack. Going past it is an ErrNestingTooDeep
+// error. A limit below 1 means DefaultMaxDepth
+func WithMaxDepth(depth int) Option {
+	return func(p *Parser) {
+		if depth < 1 {
+			depth = DefaultMaxDepth
+		}
+		p.maxDepth = depth
+	}
+}
+
 // New function returns an intial Parser that has a lexer, errors, curToken and the peekToken
-func New(l *lexer.Lexer) *Parser {
+// The options can extend the language with new operators and statements
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:                l,
+		errors:           []*ParseError{},
+		precedences:      precedences,
+		rightAssociative: rightAssociative,
+		maxDepth:         DefaultMaxDepth,
 	}
 
-	// Intialize the prefixParseFns map on Parser and register a parsing function
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	// Register a parsing function for every token in prefix position
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
-
-	// Intialize the infixParseFns map on Parser and register a parsing function
-	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+
+	// Register a parsing function for every token in infix position
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
@@ -131,6 +263,27 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.ARROW, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// Read two token so curToken and peekToken are both set
 	p.nextToken()
@@ -141,8 +294,24 @@ func New(l *lexer.Lexer) *Parser {
 
 // nextToken is a helper method that advances curToken and peekToken
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if p.backedUp {
+		p.peekToken = p.backupToken
+		p.backedUp = false
+	} else {
+		p.peekToken = p.l.NextToken()
+	}
+	p.nesting += nesting(p.curToken.Type)
+}
+
+// backup moves the parser back by one token, so curToken is prevToken
+// again. It can't be called twice without a nextToken in between
+func (p *Parser) backup() {
+	p.nesting -= nesting(p.curToken.Type)
+	p.backupToken, p.backedUp = p.peekToken, true
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
 }
 
 // ParseProgram consturcts the AST
@@ -170,13 +339,68 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatement parses a statement and recovers from the syntax errors
+// in it. A statement with an error is skipped and an *ast.BadStatement
+// takes its place, so the next statement is parsed like nothing happened
 func (p *Parser) parseStatement() ast.Statement {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > p.maxDepth {
+		p.nestingError()
+		return nil
+	}
+
+	// The error belongs to a statement around this one, that statement
+	// recovers from it
+	if p.panicking {
+		return p.parseAnyStatement()
+	}
+
+	if p.traceOut != nil {
+		defer p.untrace(p.trace("Statement"))
+	}
+
+	start := p.curToken
+	base := p.nesting - nesting(start.Type)
+	stmt := p.parseAnyStatement()
+	if p.panicking {
+		return p.recoverStatement(start, base)
+	}
+
+	return stmt
+}
+
+// parseAnyStatement calls the parse function for the kind of statement
+// that starts with p.curToken
+func (p *Parser) parseAnyStatement() ast.Statement {
+	// A nil *ast.LetStatement or *ast.ReturnStatement must not be returned
+	// as a non-nil ast.Statement, so we check them before returning
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseBranchStatement()
+	case token.LBRACE:
+		// A { at the start of a statement is always a block. In any other
+		// place it's a hash literal, to start a statement with a hash it has
+		// to be put in parentheses: ({"a": 1})["a"]
+		return p.parseBlockStatement()
 	default:
+		if fn := p.statementParseFns[p.curToken.Type]; fn != nil {
+			return fn(p)
+		}
 		return p.parseExpressionStatement()
 	}
 }
@@ -200,10 +424,17 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// Then it jumps over the expression following the equal sign until it
-	// encounters a semi-colon
-	// TODO: we're skipping the expression until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+	// Then it expects the expression that produces the value
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.EOF) {
+		p.missingExpressionError("=")
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	// The semi-colon at the end is optional
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -213,20 +444,168 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 // parseReturnStatement constructs an ast,ReturnStatement, with the current
 // token it's sitting on as Token. It then brings the parsr in place for the
 // expression that comes next by calling nextToken()
+//
+// A return without a value is allowed when nothing follows it in the
+// statement, ex: return; or if (x) { return }. ReturnValue is nil then
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
+	if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+		stmt.ReturnValue = p.parseExpression(LOWEST)
+	}
+
+	// The semi-colon at the end is optional
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseWhileStatement parses while (condition) { body }
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForStatement parses for (init; condition; post) { body }
+// Each of the three parts can be left out, but the semicolons between them
+// have to be there. The init part is a let statement or an expression
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// The init statement. Both kinds of statement move on to the semicolon
+	// that ends them
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		if p.curTokenIs(token.LET) {
+			letStmt := p.parseLetStatement()
+			if letStmt == nil {
+				return nil
+			}
+			stmt.Init = letStmt
+		} else {
+			stmt.Init = p.parseExpressionStatement()
+		}
+
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	// The condition
 	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	// The post expression
+	p.nextToken()
+	if !p.curTokenIs(token.RPAREN) {
+		stmt.Post = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
 
-	// Then it jumps over the expression until it encounters a semi-colon
-	// TODO: we're skipping the expression until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseLoopBody parses the block of a loop, inside of it break and continue
+// are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// parseBranchStatement parses break and continue, both are only allowed
+// inside of a loop. The semicolon after them is optional
+func (p *Parser) parseBranchStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s is not in a loop", p.curToken.Literal)
+		p.AddError(ErrBranchOutsideLoop, p.curToken, msg)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+// parseBlockStatement parses the statements between { and }. It's called
+// with p.curToken on the { and stops on the matching }
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	if p.traceOut != nil {
+		defer p.untrace(p.trace("Block"))
+	}
+
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	// Running out of input before the } is an error
+	if p.curTokenIs(token.EOF) {
+		p.curError(token.RBRACE)
+	}
+
+	return block
+}
+
 // We build the AST and try to fill the fields by calling other functions
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
@@ -243,19 +622,52 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // parseExpression checks whether we have a parsing function associated
 // with p.curToken.Type in the prefix position
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if p.traceOut != nil {
+		defer p.untrace(p.trace("Expression " + precedenceName(precedence)))
+	}
+
+	// Every operand of an operator and every bracket goes one level deeper,
+	// without a limit an input like ((((... would use up the stack
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > p.maxDepth {
+		p.nestingError()
+		return p.badExpression()
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		return p.badExpression()
+	}
+
+	if p.traceOut != nil {
+		p.trace("Prefix " + p.curToken.Type.String())
 	}
 	leftExp := prefix()
+	if p.traceOut != nil {
+		p.untrace("Prefix")
+	}
 
 	// Find infixParseFns for the next token
 	// If it finds a function, it calls it
 	// passing in the expression returned by a prefixParseFn
 	// as an argument
 	// This is repeated until the statement ends with a semicolon
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	// After a syntax error there is no point in going on, the statement
+	// is going to be skipped
+	//
+	// Every operator applied here puts the expression so far one level
+	// deeper into the tree. The loop doesn't recurse, but a chain like
+	// a[0][0]... or x + x + ... makes a tree as deep as the chain is long,
+	// and the code walking that tree does recurse. So it counts as well
+	applied := 0
+	defer func() { p.depth -= applied }()
+	for !p.panicking && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		if p.traceOut != nil {
+			p.traceLoop(precedence)
+		}
+
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -263,7 +675,24 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 		p.nextToken()
 
+		p.depth++
+		applied++
+		if p.depth > p.maxDepth {
+			p.nestingError()
+			return p.badExpression()
+		}
+
+		if p.traceOut != nil {
+			p.trace("Infix " + p.curToken.Type.String())
+		}
 		leftExp = infix(leftExp)
+		if p.traceOut != nil {
+			p.untrace("Infix")
+		}
+	}
+
+	if p.traceOut != nil {
+		p.traceLoop(precedence)
 	}
 
 	return leftExp
@@ -281,11 +710,16 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	// It converts the string in p.curToken.Literal into an int64
+	// Base 0 lets strconv handle the 0x, 0o and 0b prefixes and the '_'
+	// separators, the lexer already made sure the literal is well formed
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		if errors.Is(err, strconv.ErrRange) {
+			msg = fmt.Sprintf("integer literal %s is out of range", p.curToken.Literal)
+		}
+		p.AddError(ErrInvalidNumber, p.curToken, msg)
+		return p.badExpression()
 	}
 
 	// We then save the int64 to the Value field
@@ -294,6 +728,257 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// parseFloatLiteral parses a floating point literal the same way
+// parseIntegerLiteral does for integers
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			msg = fmt.Sprintf("float literal %s is out of range", p.curToken.Literal)
+		}
+		p.AddError(ErrInvalidNumber, p.curToken, msg)
+		return p.badExpression()
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// parseBoolean turns true and false into an *ast.Boolean
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+// parseNull turns null into an *ast.NullLiteral
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
+// parseIfExpression parses if (condition) { consequence } else { alternative }
+// The else part is optional
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseFunctionLiteral parses fn(parameters) { body }
+// A loop around the function doesn't reach into its body, so break and
+// continue in the body only count loops of the function itself
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
+	return lit
+}
+
+// parseFunctionParameters parses the comma separated identifiers between
+// ( and ). Like in calls, a trailing comma is allowed. It returns nil if the
+// list is malformed and an empty slice for ()
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.COMMA) {
+			if !p.peekTokenIs(token.RPAREN) {
+				p.peekError(token.COMMA, token.RPAREN)
+				return nil
+			}
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+// parseCallExpression is the infix parse function of (. The expression in
+// front of the ( is the function that's called
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+
+	return exp
+}
+
+// parseArrayLiteral parses the elements of an array between [ and ]
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+
+	return array
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token, it's used for call arguments and array elements. A trailing comma
+// is allowed, so a long list can have one element per line.
+// It returns nil if the list is malformed and an empty slice for an empty list
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	for !p.peekTokenIs(end) {
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.COMMA) {
+			// Another element would have been fine too
+			if !p.peekTokenIs(end) {
+				p.peekError(token.COMMA, end)
+				return nil
+			}
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+// parseHashLiteral parses {key: value, ...} where keys and values are any
+// expression. Like in arrays, a trailing comma is allowed
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) {
+			if !p.peekTokenIs(token.COMMA) {
+				p.peekError(token.COMMA, token.RBRACE)
+				return nil
+			}
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseIndexExpression is the infix parse function of [. It parses an index
+// expression like array[i] or a slice expression like array[low:high],
+// where low and high are optional
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	var low ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		low = p.parseExpression(LOWEST)
+	}
+
+	if !p.peekTokenIs(token.COLON) {
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+
+		return &ast.IndexExpression{Token: tok, Left: left, Index: low}
+	}
+
+	// A slice, we are on the : now
+	p.nextToken()
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		slice.High = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return slice
+}
+
+// parseStringLiteral returns a *ast.StringLiteral. The lexer has already
+// taken care of the quotes and escape sequences, so the literal of the
+// token is the value of the string
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 // parsePrefixExpression builds an AST node, in this case *ast.PrefixExpression
 // It also advances our token by calling p.nextToken()
 // When this function is called, p.curToken is either of type token.BANG(!)
@@ -318,6 +1003,9 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 // Before advancing the token by calling nextToken and filling the Right
 // field of the node with another call to parseExression by passing the
 // precedence of the operator token
+//
+// For a right associative operator we pass a precedence one lower, this way
+// the same operator coming up next binds to the right side first
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -326,6 +1014,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if p.rightAssociative[p.curToken.Type] {
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -345,11 +1036,82 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+// parseIllegal reports the errors the lexer recorded for the token.ILLEGAL
+// token we are sitting on, ex: "invalid UTF-8 encoding (byte 0xff)".
+// An error belongs to the token if it was found inside of the token, a
+// malformed string literal can contain more than one error. The error
+// starts where the lexer found it and ends with the token.
+//
+// The token is a value that went wrong, not a syntax error, so the parser
+// goes on with a *ast.BadExpression in its place
+func (p *Parser) parseIllegal() ast.Expression {
+	// The lexer finds the errors of one token after the other, the ones of
+	// the tokens we have moved past don't have to be looked at again. What
+	// is left belongs to curToken and the token or two the lexer is ahead
+	errs := p.l.Errors()
+	for p.lexErr < len(errs) && errs[p.lexErr].Pos.Offset < p.curToken.Start.Offset {
+		p.lexErr++
+	}
+
+	found := false
+	for _, err := range errs[p.lexErr:] {
+		if err.Pos.Offset != p.curToken.Start.Offset &&
+			(err.Pos.Offset < p.curToken.Start.Offset || err.Pos.Offset >= p.curToken.End.Offset) {
+			continue
+		}
+		p.report(&ParseError{
+			Code:  ErrIllegalToken,
+			Msg:   err.Msg,
+			Start: err.Pos,
+			End:   p.curToken.End,
+			Token: p.curToken,
+		})
+		found = true
+	}
+
+	if !found {
+		p.noPrefixParseFnError(p.curToken.Type)
+	}
+
+	return p.badExpression()
+}
+
+// badExpression returns an *ast.BadExpression for p.curToken
+func (p *Parser) badExpression() ast.Expression {
+	return &ast.BadExpression{Token: p.curToken, End: p.curToken.End}
+}
+
+// missingExpressionError reports that an expression was expected after the
+// given token, but the statement ended instead
+func (p *Parser) missingExpressionError(after string) {
+	msg := fmt.Sprintf("expected an expression after %s, got %s instead", after, p.peekToken.Type)
+	p.AddError(ErrMissingExpression, p.peekToken, msg, p.expressionStarts()...)
+}
+
+// nestingError reports that the input is nested deeper than maxDepth
+func (p *Parser) nestingError() {
+	msg := fmt.Sprintf("nesting is too deep, the limit is %d levels", p.maxDepth)
+	p.AddError(ErrNestingTooDeep, p.curToken, msg)
+}
+
 // noPrefixParseFnError adds a formatted error message to our Parser's
 // errors field.
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.AddError(ErrNoPrefixParseFn, p.curToken, msg, p.expressionStarts()...)
+}
+
+// expressionStarts returns the token types an expression can start with,
+// the ones with a prefix parse function. An ILLEGAL token has one only to
+// report itself
+func (p *Parser) expressionStarts() []token.TokenType {
+	var types []token.TokenType
+	for t, fn := range p.prefixParseFns {
+		if fn != nil && token.TokenType(t) != token.ILLEGAL {
+			types = append(types, token.TokenType(t))
+		}
+	}
+	return types
 }
 
 // Check if the curToken type is equal to the type in parameter
@@ -385,14 +1147,36 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-// Errors will check if the parser has encountered any errors
-func (p *Parser) Errors() []string {
+// Errors returns the errors the parser has encountered, in the order it
+// found them. Each error prints as "line:column: message"
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
 // peekError is used to add an error to errors when the type of peekToken
 // does not match the expectation.
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+func (p *Parser) peekError(expected ...token.TokenType) {
+	p.unexpectedTokenError(p.peekToken, expected)
+}
+
+// curError is peekError for when the parser already moved on to the
+// unexpected token
+func (p *Parser) curError(expected ...token.TokenType) {
+	p.unexpectedTokenError(p.curToken, expected)
+}
+
+// unexpectedTokenError reports that tok is none of the expected types, the
+// message names all of them, ex: expected token to be , or ), got INT instead
+func (p *Parser) unexpectedTokenError(tok token.Token, expected []token.TokenType) {
+	names := make([]string, len(expected))
+	for i, t := range expected {
+		names[i] = t.String()
+	}
+	list := names[len(names)-1]
+	if len(names) > 1 {
+		list = strings.Join(names[:len(names)-1], ", ") + " or " + list
+	}
+
+	msg := fmt.Sprintf("expected token to be %s, got %s instead", list, tok.Type)
+	p.AddError(ErrUnexpectedToken, tok, msg, expected...)
 }
@@ -1,47 +1,57 @@
 package parser
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/thewebdevel/monkey-interpreter/ast"
+	"github.com/thewebdevel/monkey-interpreter/internal/corpus"
 	"github.com/thewebdevel/monkey-interpreter/lexer"
+	"github.com/thewebdevel/monkey-interpreter/token"
 )
 
 // We are checking as many fields of the AST nodes as possible
 // and make sure nothing is missing
 func TestLetStatements(t *testing.T) {
-	// We provide monkey source code as an input
-	input := `
-		let x = 5;
-		let y = 10;
-		let foobar = 838383; `
-
-	l := lexer.New(input)
-	p := New(l)
-
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram returned nil")
-	}
-	if len(program.Statements) != 3 {
-		t.Fatalf("prgram.Statements does not contain 3 statements. got=%d", len(program.Statements))
-	}
-
 	tests := []struct {
+		input              string
 		expectedIdentifier string
+		expectedValue      string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"let x = 5;", "x", "5"},
+		{"let y = true;", "y", "true"},
+		{"let foobar = y;", "foobar", "y"},
+		{"let sum = a + b * c", "sum", "(a + (b * c))"},
 	}
 
-	for i, tt := range tests {
-		stmt := program.Statements[i]
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program == nil {
+			t.Fatalf("ParseProgram returned nil")
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("prgram.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
 		if !testLetStatements(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+
+		value := stmt.(*ast.LetStatement).Value
+		if value.String() != tt.expectedValue {
+			t.Errorf("letStmt.Value wrong. expected=%q, got=%q", tt.expectedValue, value.String())
+		}
 	}
 }
 
@@ -58,38 +68,88 @@ func testLetStatements(t *testing.T, s ast.Statement, name string) bool {
 		return false
 	}
 
-	if letStmt.Name.Value != name {
-		t.Errorf("letStmt.Name.Value is not '%s'. got=%s", name, letStmt.Name.TokenLiteral())
-		return false
+	return testTree(t, letStmt.Name, ident(name))
+}
+
+func TestReturnStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+	}{
+		{"return 5;", "5"},
+		{"return x", "x"},
+		{"return a + b;", "(a + b)"},
+		{"return;", ""},
+		{"return", ""},
 	}
 
-	return true
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("prgram.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+
+		if returnStmt.TokenLiteral() != "return" {
+			t.Errorf("returnStmt.TokenLiteral not 'return', got %q", returnStmt.TokenLiteral())
+		}
+
+		value := ""
+		if returnStmt.ReturnValue != nil {
+			value = returnStmt.ReturnValue.String()
+		}
+		if value != tt.expectedValue {
+			t.Errorf("returnStmt.ReturnValue wrong. expected=%q, got=%q", tt.expectedValue, value)
+		}
+	}
 }
 
-func TestReturnStatement(t *testing.T) {
-	input := `return 5;
-		return 10;
-		return 993322;`
+func TestStatementsWithoutSemicolons(t *testing.T) {
+	input := `
+		let x = 5
+		let y = x * 2
+		return x + y
+		if (x) { return } else { return y }`
 
 	l := lexer.New(input)
 	p := New(l)
-
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("prgram.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	expected := "let x = 5; let y = x * 2; return x + y; if (x) { return; } else { return y; }"
+	testSameTree(t, program, expected)
+}
+
+func TestLetStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = ;", "expected an expression after =, got ; instead"},
+		{"let x =", "expected an expression after =, got EOF instead"},
+		{"let x 5;", "expected token to be =, got INT instead"},
 	}
 
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
-		if !ok {
-			t.Errorf("stmt not *ast.ReturnStatement. got=%T", stmt)
-			continue
-		}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
 
-		if returnStmt.TokenLiteral() != "return" {
-			t.Errorf("returnStmt.TokenLiteral not 'return', got %q", returnStmt.TokenLiteral())
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("parser has no errors for %q", tt.input)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
 		}
 	}
 }
@@ -114,24 +174,116 @@ func TestIdentifierExpression(t *testing.T) {
 		t.Fatalf("program.Statement[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
 	}
 
-	ident, ok := stmt.Expression.(*ast.Identifier)
+	// check if the *ast.ExpressionStatement.Expression is the identifier
+	// foobar, with its token
+	testTree(t, stmt.Expression, ident("foobar"))
+}
+
+func TestIntegerLiteralExpression(t *testing.T) {
+	input := "5;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
 
-	// check if the *ast.ExpressionStatement.Expression is an *ast.Identifier
 	if !ok {
-		t.Fatalf("exp not *ast.Identifier. got=%T", stmt.Expression)
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	testIntegerLiteral(t, stmt.Expression, 5)
+}
+
+func TestNumberLiteralExpressions(t *testing.T) {
+	intTests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+	}
+
+	for _, tt := range intTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
 	}
 
-	// Check if our identifier has the correct value of foobar
-	if ident.Value != "foobar" {
-		t.Errorf("ident.Value not %s. got=%s", "foobar", ident.Value)
+	floatTests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e3", 1000},
+		{"2.5E-3", 0.0025},
+		{"1_000.5", 1000.5},
 	}
-	if ident.TokenLiteral() != "foobar" {
-		t.Errorf("ident.TokenLiteral not %s. got=%s", "foobar", ident.TokenLiteral())
+
+	for _, tt := range floatTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
 	}
 }
 
-func TestIntegerLiteralExpression(t *testing.T) {
-	input := "5;"
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "integer literal 9223372036854775808 is out of range"},
+		{"1e400", "float literal 1e400 is out of range"},
+		{"0x", "hexadecimal literal has no digits"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("parser has wrong number of errors for %q. got=%v", tt.input, errors)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello\tworld";`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -143,21 +295,19 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 
 	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-
 	if !ok {
 		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
 	}
 
-	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
-
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
 	if !ok {
-		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
 	}
-	if literal.Value != 5 {
-		t.Errorf("literal.Value not %d. got=%d", 5, literal.Value)
+	if literal.Value != "hello\tworld" {
+		t.Errorf("literal.Value not %q. got=%q", "hello\tworld", literal.Value)
 	}
-	if literal.TokenLiteral() != "5" {
-		t.Errorf("literal.TokenLiteral not %s. got=%s", "5", literal.TokenLiteral())
+	if literal.String() != input[:len(input)-1] {
+		t.Errorf("literal.String() not %q. got=%q", input[:len(input)-1], literal.String())
 	}
 }
 
@@ -200,23 +350,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 }
 
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
-	integ, ok := il.(*ast.IntegerLiteral)
-	if !ok {
-		t.Errorf("il is not *ast.IntegerLiteral. got=%T", il)
-		return false
-	}
-
-	if integ.Value != value {
-		t.Errorf("integ.TokenLiteral not %d. got=%d", integ.Value, value)
-		return false
-	}
-
-	if integ.TokenLiteral() != fmt.Sprintf("%d", value) {
-		t.Errorf("integer.TokenLiteral not %d. got=%s", value, integ.TokenLiteral())
-		return false
-	}
-
-	return true
+	return testTree(t, il, integer(value))
 }
 
 func TestParsingInfixExpressions(t *testing.T) {
@@ -234,6 +368,21 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 && 5;", 5, "&&", 5},
+		{"5 || 5;", 5, "||", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"5 -> 5;", 5, "->", 5},
+		{"5 |> 5;", 5, "|>", 5},
+		{"5 += 5;", 5, "+=", 5},
+		{"5 -= 5;", 5, "-=", 5},
+		{"5 *= 5;", 5, "*=", 5},
+		{"5 /= 5;", 5, "/=", 5},
+		{"5 %= 5;", 5, "%=", 5},
 	}
 
 	for _, tt := range infixTests {
@@ -305,7 +454,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4); ((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -319,31 +468,1430 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"-f(x) ** g(y)",
+			"(-(f(x) ** g(y)))",
+		},
+		{
+			"x |> f(y)",
+			"(x |> f(y))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"-a[1:2]",
+			"(-(a[1:2]))",
+		},
+		{
+			"f(x)[0]",
+			"(f(x)[0])",
+		},
+		{
+			"true",
+			"true",
+		},
+		{
+			"3 > 5 == false",
+			"((3 > 5) == false)",
+		},
+		{
+			"!true != null",
+			"((!true) != null)",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a << b + c < d >> e",
+			"((a << (b + c)) < (d >> e))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b * c",
+			"((-(a ** b)) * c)",
+		},
+		{
+			"a ** -b",
+			"(a ** (-b))",
+		},
+		{
+			"a |> f |> g",
+			"((a |> f) |> g)",
+		},
+		{
+			"a || b |> f",
+			"((a || b) |> f)",
+		},
+		{
+			"a -> b -> c |> d",
+			"(a -> (b -> (c |> d)))",
+		},
+		{
+			"x += y -= z * 2",
+			"(x += (y -= (z * 2)))",
+		},
+		{
+			"x += a -> b",
+			"(x += (a -> b))",
+		},
 	}
 
+	// The expected programs have every operator in parentheses, they parse
+	// into the trees the inputs have to give
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
 		p := New(l)
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		actual := program.String()
-		if actual != tt.expected {
-			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		want := New(lexer.New(tt.expected)).ParseProgram()
+		if len(program.Statements) != len(want.Statements) {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d", tt.input, len(want.Statements), len(program.Statements))
+			continue
+		}
+		for i, stmt := range program.Statements {
+			got := stmt.(*ast.ExpressionStatement).Expression
+			if !testTree(t, got, want.Statements[i].(*ast.ExpressionStatement).Expression) {
+				t.Errorf("wrong tree for %q, expected %q", tt.input, tt.expected)
+			}
 		}
 	}
 }
 
-func checkParserErrors(t *testing.T, p *Parser) {
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + \xff", "invalid UTF-8 encoding (byte 0xff)"},
+		{"@", "unexpected character '@'"},
+		{`"abc`, "string literal not terminated"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("parser has wrong number of errors for %q. got=%v", tt.input, errors)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
+		}
+	}
+}
+
+// Every token.ILLEGAL gets its own lexer error, no matter how many of them
+// there are
+func TestManyIllegalTokens(t *testing.T) {
+	input := strings.Repeat("@; ", 10000)
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
 	errors := p.Errors()
-	if len(errors) == 0 {
-		return
+	if len(errors) != 10000 {
+		t.Fatalf("parser has wrong number of errors. got=%d", len(errors))
+	}
+	for i, err := range errors {
+		if err.Start.Offset != 3*i || err.Msg != "unexpected character '@'" {
+			t.Fatalf("wrong error %d. got=%d %q", i, err.Start.Offset, err.Msg)
+		}
 	}
+}
 
-	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+// A reader that fails mustn't look like a program that ends early
+func TestReadErrorIsReported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 +", "read error: broken pipe"},
+		{"let x = 1;", "read error: broken pipe"},
+		{"let x", "expected token to be =, got ILLEGAL instead"},
 	}
 
-	t.FailNow()
+	for _, tt := range tests {
+		r := io.MultiReader(strings.NewReader(tt.input), iotest.ErrReader(errors.New("broken pipe")))
+		p := New(lexer.NewReader(r))
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("parser has wrong number of errors for %q. got=%v", tt.input, errs)
+		}
+		if errs[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errs[0].Msg)
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	// Where an expression is missing, everything an expression can start
+	// with would have been fine
+	starts := []token.TokenType{
+		token.IDENT, token.INT, token.FLOAT, token.STRING, token.MINUS, token.BANG,
+		token.LPAREN, token.LBRACE, token.LBRACKET, token.FUNCTION, token.TRUE,
+		token.FALSE, token.IF, token.NULL,
+	}
+
+	tests := []struct {
+		input    string
+		code     ErrorCode
+		token    token.TokenType
+		start    int
+		end      int
+		expected []token.TokenType
+		rendered string
+	}{
+		{"let x = (1 + 2", ErrUnexpectedToken, token.EOF, 14, 14,
+			[]token.TokenType{token.RPAREN},
+			"main.mk:1:15: expected token to be ), got EOF instead"},
+		{"let x 5;", ErrUnexpectedToken, token.INT, 6, 7,
+			[]token.TokenType{token.ASSIGN},
+			"main.mk:1:7: expected token to be =, got INT instead"},
+		{"if (x) {\n  y", ErrUnexpectedToken, token.EOF, 12, 12,
+			[]token.TokenType{token.RBRACE},
+			"main.mk:2:4: expected token to be }, got EOF instead"},
+		{"f(1 2)", ErrUnexpectedToken, token.INT, 4, 5,
+			[]token.TokenType{token.COMMA, token.RPAREN},
+			"main.mk:1:5: expected token to be , or ), got INT instead"},
+		{"({a: 1 b: 2})", ErrUnexpectedToken, token.IDENT, 7, 8,
+			[]token.TokenType{token.COMMA, token.RBRACE},
+			"main.mk:1:8: expected token to be , or }, got IDENT instead"},
+		{"fn(a b) {}", ErrUnexpectedToken, token.IDENT, 5, 6,
+			[]token.TokenType{token.COMMA, token.RPAREN},
+			"main.mk:1:6: expected token to be , or ), got IDENT instead"},
+		{"x + *", ErrNoPrefixParseFn, token.ASTERISK, 4, 5, starts,
+			"main.mk:1:5: no prefix parse function for * found"},
+		{"let x =", ErrMissingExpression, token.EOF, 7, 7, starts,
+			"main.mk:1:8: expected an expression after =, got EOF instead"},
+		{"99999999999999999999", ErrInvalidNumber, token.INT, 0, 20, nil,
+			"main.mk:1:1: integer literal 99999999999999999999 is out of range"},
+		{"break;", ErrBranchOutsideLoop, token.BREAK, 0, 5, nil,
+			"main.mk:1:1: break is not in a loop"},
+		{`"a\qb"`, ErrIllegalToken, token.ILLEGAL, 2, 6, nil,
+			`main.mk:1:3: unknown escape sequence \q`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, lexer.WithFilename("main.mk"))
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("parser has wrong number of errors for %q. got=%v", tt.input, errors)
+		}
+
+		err := errors[0]
+		if err.Code != tt.code {
+			t.Errorf("wrong code for %q. expected=%s, got=%s", tt.input, tt.code, err.Code)
+		}
+		if err.Token.Type != tt.token {
+			t.Errorf("wrong token for %q. expected=%s, got=%s", tt.input, tt.token, err.Token.Type)
+		}
+		if err.Start.Offset != tt.start || err.End.Offset != tt.end {
+			t.Errorf("wrong span for %q. expected=%d-%d, got=%d-%d",
+				tt.input, tt.start, tt.end, err.Start.Offset, err.End.Offset)
+		}
+		if fmt.Sprint(err.Expected) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong expected tokens for %q. expected=%v, got=%v", tt.input, tt.expected, err.Expected)
+		}
+		if err.Error() != tt.rendered {
+			t.Errorf("wrong rendering for %q. expected=%q, got=%q", tt.input, tt.rendered, err.Error())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   []string
+	}{
+		{
+			"let 5 = x; let y = 2;",
+			"<bad statement>let y = 2;",
+			[]string{"expected token to be IDENT, got INT instead"},
+		},
+		{
+			"let x 5\nlet y = 2",
+			"<bad statement>let y = 2;",
+			[]string{"expected token to be =, got INT instead"},
+		},
+		{
+			"let x = (1 + 2; let y = 3",
+			"<bad statement>let y = 3;",
+			[]string{"expected token to be ), got ; instead"},
+		},
+		{
+			"foo(1, 2 3); bar()",
+			"<bad statement>bar()",
+			[]string{"expected token to be , or ), got INT instead"},
+		},
+		{
+			"while (x { y } let z = 1",
+			"<bad statement>let z = 1;",
+			[]string{"expected token to be ), got { instead"},
+		},
+		{
+			"if (x) { 1 + } let y = 2",
+			"if x {<bad statement>}let y = 2;",
+			[]string{"no prefix parse function for } found"},
+		},
+		{
+			"let f = fn() { let a = ; return 1 }; let g = fn() { x y };",
+			"let f = fn() {<bad statement>return 1;};let g = fn() {xy};",
+			[]string{"expected an expression after =, got ; instead"},
+		},
+		{
+			"{ let h = {a: 1 b: 2}; x } y",
+			"{<bad statement>x}y",
+			[]string{"expected token to be , or }, got IDENT instead"},
+		},
+		{
+			"let a = 1 +; let b = ; let c = 3",
+			"<bad statement><bad statement>let c = 3;",
+			[]string{
+				"no prefix parse function for ; found",
+				"expected an expression after =, got ; instead",
+			},
+		},
+		{
+			"let x = 99999999999999999999 + 1; y",
+			"let x = (<bad expression> + 1);y",
+			[]string{"integer literal 99999999999999999999 is out of range"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%v", tt.input, len(tt.errors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Msg != tt.errors[i] {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.errors[i], err.Msg)
+			}
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	input := "let x = foo(1 2);\nlet y = 2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.BadStatement. got=%T", program.Statements[0])
+	}
+	if bad.Token.Type != token.LET || bad.Token.Start.Offset != 0 {
+		t.Errorf("bad.Token wrong. got=%+v", bad.Token)
+	}
+	if bad.End.Offset != 17 {
+		t.Errorf("bad.End.Offset wrong. expected=17, got=%d", bad.End.Offset)
+	}
+
+	testLetStatements(t, program.Statements[1], "y")
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedBoolean bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		boolean, ok := stmt.Expression.(*ast.Boolean)
+		if !ok {
+			t.Fatalf("exp not *ast.Boolean. got=%T", stmt.Expression)
+		}
+		if boolean.Value != tt.expectedBoolean {
+			t.Errorf("boolean.Value not %t. got=%t", tt.expectedBoolean, boolean.Value)
+		}
+	}
+}
+
+func TestNullLiteral(t *testing.T) {
+	l := lexer.New("null;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	if _, ok := stmt.Expression.(*ast.NullLiteral); !ok {
+		t.Fatalf("exp not *ast.NullLiteral. got=%T", stmt.Expression)
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	testTree(t, exp.Condition, expression(t, "x < y"))
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n", len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+	}
+
+	testTree(t, consequence.Expression, ident("x"))
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y; z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if exp.Alternative == nil {
+		t.Fatalf("exp.Alternative is nil")
+	}
+
+	if len(exp.Alternative.Statements) != 2 {
+		t.Fatalf("alternative is not 2 statements. got=%d\n", len(exp.Alternative.Statements))
+	}
+
+	testTree(t, exp.Condition, expression(t, "x < y"))
+	for i, name := range []string{"y", "z"} {
+		alternative, ok := exp.Alternative.Statements[i].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] is not ast.ExpressionStatement. got=%T", i, exp.Alternative.Statements[i])
+		}
+		testTree(t, alternative.Expression, ident(name))
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x += 1; if (x == 5) { break; } continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	testTree(t, stmt.Condition, expression(t, "x < 10"))
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("Body.Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+
+	testSameTree(t, program, "while ((x < 10)) { x += (1)\n if ((x == 5)) { break } continue; }")
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { x }", "for (let i = (0); (i < 10); (i += 1)) {x}"},
+		{"for (i; i; i) { }", "for (i; (i); (i)) {}"},
+		{"for (;;) { break }", "for ( ; ; ) {break;}"},
+		{"for (; done; ) { }", "for (; (done); ) {}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		if _, ok := program.Statements[0].(*ast.ForStatement); !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		testSameTree(t, program, tt.expected)
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	}
+
+	if function.Parameters[0].Value != "x" || function.Parameters[1].Value != "y" {
+		t.Fatalf("function literal parameters wrong. got=%v", function.Parameters)
+	}
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+
+	testTree(t, bodyStmt.Expression, expression(t, "x + y"))
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{input: "fn(x,) {};", expectedParams: []string{"x"}},
+		{input: "fn(\n\tx,\n\ty,\n) {};", expectedParams: []string{"x", "y"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			if function.Parameters[i].Value != ident {
+				t.Errorf("parameter %d wrong. want %s, got=%s", i, ident, function.Parameters[i].Value)
+			}
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	testTree(t, exp.Function, ident("add"))
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testIntegerLiteral(t, exp.Arguments[0], 1)
+	testTree(t, exp.Arguments[1], expression(t, "2 * 3"))
+	testTree(t, exp.Arguments[2], expression(t, "4 + 5"))
+}
+
+func TestCallExpressionArgumentParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedIdent string
+		expectedArgs  []string
+	}{
+		{"add();", "add", []string{}},
+		{"add(1);", "add", []string{"1"}},
+		{"add(1, 2 * 3, 4 + 5);", "add", []string{"1", "(2 * 3)", "(4 + 5)"}},
+		{"f(g(x), h(y, z))(w);", "f(g(x), h(y, z))", []string{"w"}},
+		{"fn(x) { x }(5);", "fn(x) {x}", []string{"5"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+		}
+
+		testTree(t, exp.Function, expression(t, tt.expectedIdent))
+
+		if len(exp.Arguments) != len(tt.expectedArgs) {
+			t.Fatalf("wrong number of arguments. want=%d, got=%d", len(tt.expectedArgs), len(exp.Arguments))
+		}
+
+		for i, arg := range tt.expectedArgs {
+			testTree(t, exp.Arguments[i], expression(t, arg))
+		}
+	}
+}
+
+func TestFunctionLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(, x) {}", "expected token to be IDENT, got , instead"},
+		{"fn(x,,) {}", "expected token to be IDENT, got , instead"},
+		{"fn(x y) {}", "expected token to be , or ), got IDENT instead"},
+		{"fn(x) x", "expected token to be {, got IDENT instead"},
+		{"add(1, 2", "expected token to be , or ), got EOF instead"},
+		{"while (true) { fn() { break } }", "break is not in a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("parser has no errors for %q", tt.input)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
+		}
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, f(x), \"three\",]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 4 {
+		t.Fatalf("len(array.Elements) not 4. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testTree(t, array.Elements[1], expression(t, "2 * 2"))
+	testTree(t, array.Elements[2], expression(t, "f(x)"))
+	testTree(t, array, expression(t, `[1, (2 * 2), f(x), "three"]`))
+}
+
+func TestParsingEmptyArrayLiteral(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	testTree(t, indexExp.Left, ident("myArray"))
+	testTree(t, indexExp.Index, expression(t, "1 + 1"))
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedLow  string
+		expectedHigh string
+	}{
+		{"arr[1:3]", "1", "3"},
+		{"arr[:n - 1]", "", "(n - 1)"},
+		{"arr[i:]", "i", ""},
+		{"arr[:]", "", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		testTree(t, slice.Left, ident("arr"))
+
+		// A bound that's left out is nil
+		var low, high ast.Expression
+		if tt.expectedLow != "" {
+			low = expression(t, tt.expectedLow)
+		}
+		if tt.expectedHigh != "" {
+			high = expression(t, tt.expectedHigh)
+		}
+		testTree(t, slice.Low, low)
+		testTree(t, slice.High, high)
+	}
+}
+
+// The String() of arrays, index and slice expressions can be parsed again
+// and gives back the same tree
+func TestCollectionStringRoundTrip(t *testing.T) {
+	inputs := []string{
+		"[1, 2 * 3, f(x)]",
+		"[[1, 2], [], [\"a\\n\"]]",
+		"a[b[0]][1:len(a) - 1]",
+		"f(x)[0]",
+		"[1, 2, 3][:2][1:]",
+		"-a[0] ** b[1:]",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		p = New(lexer.New(program.String()))
+		again := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		// The token of the statement is the first one, a ( in the String()
+		first := program.Statements[0].(*ast.ExpressionStatement)
+		second := again.Statements[0].(*ast.ExpressionStatement)
+		testTree(t, second.Expression, first.Expression)
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let h = {}`, []string{}},
+		{`let h = {"one": 1, "two": 2, "three": 3}`, []string{`"one"`, "1", `"two"`, "2", `"three"`, "3"}},
+		{`let h = {1: true, false: null,}`, []string{"1", "true", "false", "null"}},
+		{`let h = {"a" + "b": 10 - 8, f(x): [1]}`, []string{`"a" + "b"`, "10 - 8", "f(x)", "[1]"}},
+		{`let h = {"outer": {"inner": {}}, "x": {1: 2,},}`, []string{`"outer"`, `({"inner": {}})`, `"x"`, "({1: 2})"}},
+		{"let h = {\n  \"a\": 1,\n  \"b\": 2,\n}", []string{`"a"`, "1", `"b"`, "2"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		hash, ok := stmt.Value.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Value)
+		}
+
+		// The expected keys and values take turns
+		if len(hash.Pairs) != len(tt.expected)/2 {
+			t.Fatalf("hash.Pairs has wrong length. want=%d, got=%d", len(tt.expected)/2, len(hash.Pairs))
+		}
+
+		for i, pair := range hash.Pairs {
+			testTree(t, pair.Key, expression(t, tt.expected[2*i]))
+			testTree(t, pair.Value, expression(t, tt.expected[2*i+1]))
+		}
+	}
+}
+
+// A { in statement position starts a block, anywhere else it starts a hash
+func TestBraceInStatementPosition(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType string
+		expected     string
+	}{
+		{"{ let x = 1; x }", "*ast.BlockStatement", "{let x = 1;x}"},
+		{"{}", "*ast.BlockStatement", "{}"},
+		{`({"a": 1})`, "*ast.ExpressionStatement", `{"a": 1}`},
+		{`({"a": 1})["a"]`, "*ast.ExpressionStatement", `({"a": 1}["a"])`},
+		{`f({})`, "*ast.ExpressionStatement", `f({})`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements for %q. got=%d", tt.input, len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		if fmt.Sprintf("%T", stmt) != tt.expectedType {
+			t.Errorf("statement type wrong for %q. want=%s, got=%T", tt.input, tt.expectedType, stmt)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {"a" 1}`, "expected token to be :, got INT instead"},
+		{`let h = {"a": 1 "b": 2}`, "expected token to be , or }, got STRING instead"},
+		{`let h = {"a": 1,, }`, "no prefix parse function for , found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("parser has no errors for %q", tt.input)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
+		}
+	}
+}
+
+func TestBranchOutsideOfLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "break is not in a loop"},
+		{"if (x) { continue }", "continue is not in a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("parser has wrong number of errors for %q. got=%v", tt.input, errors)
+		}
+		if errors[0].Msg != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0].Msg)
+		}
+	}
+}
+
+// newDSLParser makes a parser for a small language on top of Monkey with
+// a range operator .., an in operator, a ~ prefix operator, x => body as a
+// short way to write fn(x) { body } and an unless (cond) { ... } statement
+func newDSLParser(input string) *Parser {
+	rng := token.Register("..")
+	in := token.Register("IN")
+	tilde := token.Register("~")
+	lambda := token.Register("=>")
+	unless := token.Register("UNLESS")
+
+	l := lexer.New(input,
+		lexer.WithOperator("..", rng),
+		lexer.WithOperator("~", tilde),
+		lexer.WithOperator("=>", lambda),
+		lexer.WithKeyword("in", in),
+		lexer.WithKeyword("unless", unless),
+	)
+
+	return New(l,
+		WithInfixOperator(rng, SHIFT),
+		WithInfixOperator(in, EQUALS),
+		WithPrefixOperator(tilde),
+		WithInfix(lambda, ASSIGN, parseLambda),
+		WithStatement(unless, parseUnless),
+	)
+}
+
+// parseLambda turns x => body into fn(x) { body }. It's right associative,
+// so the body is parsed with a precedence one lower
+func parseLambda(p *Parser, left ast.Expression) ast.Expression {
+	param, ok := left.(*ast.Identifier)
+	if !ok {
+		p.AddError(ErrUnexpectedToken, p.CurToken(), "expected a parameter in front of =>")
+		return nil
+	}
+
+	p.NextToken()
+	body := p.ParseExpression(ASSIGN - 1)
+
+	return &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: []*ast.Identifier{param},
+		Body: &ast.BlockStatement{
+			Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+			Statements: []ast.Statement{&ast.ExpressionStatement{Token: p.CurToken(), Expression: body}},
+		},
+	}
+}
+
+// parseUnless turns unless (cond) { ... } into if (!cond) { ... }
+func parseUnless(p *Parser) ast.Statement {
+	tok := p.CurToken()
+	if !p.ExpectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.NextToken()
+	cond := p.ParseExpression(LOWEST)
+	if !p.ExpectPeek(token.RPAREN) || !p.ExpectPeek(token.LBRACE) {
+		return nil
+	}
+
+	return &ast.ExpressionStatement{
+		Token: tok,
+		Expression: &ast.IfExpression{
+			Token:       tok,
+			Condition:   &ast.PrefixExpression{Token: tok, Operator: "!", Right: cond},
+			Consequence: p.ParseBlockStatement(),
+		},
+	}
+}
+
+func TestCustomOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..n + 1", "(1 .. (n + 1))"},
+		{"x in 1..10 == true", "((x in (1 .. 10)) == true)"},
+		{"~a * b", "((~a) * b)"},
+		{"let inc = x => x + 1", "let inc = fn(x) {(x + 1)};"},
+		{"a => b => a + b", "fn(a) {fn(b) {(a + b)}}"},
+		{"unless (x in xs) { print(x) }", "if (!(x in xs)) {print(x)}"},
+		{"while (i) { unless (i) { break } }", "while i {if (!i) {break;}}"},
+	}
+
+	for _, tt := range tests {
+		p := newDSLParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestCustomOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   []string
+	}{
+		{
+			"1 => 2; x in y",
+			"<bad statement>(x in y)",
+			[]string{"expected a parameter in front of =>"},
+		},
+		{
+			"unless x { y }\nunless (z) { w }",
+			"<bad statement>if (!z) {w}",
+			[]string{"expected token to be (, got IDENT instead"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := newDSLParser(tt.input)
+		program := p.ParseProgram()
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+
+		errors := p.Errors()
+		if len(errors) != len(tt.errors) {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%v", tt.input, len(tt.errors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Msg != tt.errors[i] {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.errors[i], err.Msg)
+			}
+		}
+	}
+
+	// Without the options the new tokens mean nothing to the parser
+	p := New(lexer.New("1..2"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("parser without options accepted 1..2")
+	}
+}
+
+// An infix operator that doesn't bind tighter than LOWEST could never be
+// parsed, the options refuse it right away
+func TestInfixPrecedenceTooLow(t *testing.T) {
+	rng := token.Register("..")
+	options := map[string]func(){
+		"WithInfixOperator": func() { WithInfixOperator(rng, LOWEST) },
+		"WithInfix":         func() { WithInfix(rng, 0, parseLambda) },
+	}
+
+	for name, option := range options {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s accepted a precedence that isn't above LOWEST", name)
+				}
+			}()
+			option()
+		}()
+	}
+}
+
+func TestTrace(t *testing.T) {
+	input := "1 + 2 * 3"
+
+	var out strings.Builder
+	p := New(lexer.New(input), WithTrace(&out))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "(1 + (2 * 3))" {
+		t.Errorf("tracing changed the program. got=%q", program.String())
+	}
+
+	expected := `   1:1: Statement cur=INT "1" peek=+
+   1:1: . Expression LOWEST cur=INT "1" peek=+
+   1:1: . . Prefix INT cur=INT "1" peek=+
+   1:1: . . end Prefix
+   1:1: . . peek + SUM > LOWEST, parse infix
+   1:3: . . Infix + cur=+ peek=INT "2"
+   1:5: . . . Expression SUM cur=INT "2" peek=*
+   1:5: . . . . Prefix INT cur=INT "2" peek=*
+   1:5: . . . . end Prefix
+   1:5: . . . . peek * PRODUCT > SUM, parse infix
+   1:7: . . . . Infix * cur=* peek=INT "3"
+   1:9: . . . . . Expression PRODUCT cur=INT "3" peek=EOF
+   1:9: . . . . . . Prefix INT cur=INT "3" peek=EOF
+   1:9: . . . . . . end Prefix
+   1:9: . . . . . . peek EOF LOWEST <= PRODUCT, done
+   1:9: . . . . . end Expression PRODUCT
+   1:9: . . . . end Infix
+   1:9: . . . . peek EOF LOWEST <= SUM, done
+   1:9: . . . end Expression SUM
+   1:9: . . end Infix
+   1:9: . . peek EOF LOWEST <= LOWEST, done
+   1:9: . end Expression LOWEST
+   1:9: end Statement
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestTraceErrors(t *testing.T) {
+	var out strings.Builder
+	p := New(lexer.New("let x = ;"), WithTrace(&out))
+	p.ParseProgram()
+
+	for _, line := range []string{
+		"   1:7: . error: expected an expression after =, got ; instead\n",
+		"   1:9: . skipped to ;\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("trace is missing %q. got=\n%s", line, out.String())
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	const n = 1000000
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"parentheses", strings.Repeat("(", n) + "1" + strings.Repeat(")", n)},
+		{"unclosed parentheses", strings.Repeat("(", n) + ";"},
+		{"prefix operators", strings.Repeat("-", n) + "1"},
+		{"right associative operators", strings.Repeat("a ** ", n) + "a"},
+		{"arrays", strings.Repeat("[", n) + strings.Repeat("]", n)},
+		{"blocks", strings.Repeat("{", n) + strings.Repeat("}", n)},
+		{"functions", strings.Repeat("fn() {", n/10) + strings.Repeat("}", n/10)},
+		// Chains are parsed in a loop, but they make trees as deep as
+		// they are long
+		{"index chain", "a" + strings.Repeat("[0]", n)},
+		{"call chain", "f" + strings.Repeat("()", n)},
+		{"left associative operators", "x" + strings.Repeat(" + x", n)},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input + "\nlet y = 2;"))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Code != ErrNestingTooDeep {
+			t.Errorf("%s: wrong errors. got=%v", tt.name, errors)
+			continue
+		}
+
+		// The parser picks up again after the deep statement
+		last := program.Statements[len(program.Statements)-1]
+		if last.String() != "let y = 2;" {
+			t.Errorf("%s: parser didn't recover. last statement=%q", tt.name, last.String())
+		}
+	}
+
+	// Blocks that are never closed are one more error
+	p := New(lexer.New(strings.Repeat("if (x) {", n/10)))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != 2 || errors[0].Code != ErrNestingTooDeep || errors[1].Code != ErrUnexpectedToken {
+		t.Errorf("unclosed blocks: wrong errors. got=%v", errors)
+	}
+
+	// A limit of our own. The statement is a level too
+	p = New(lexer.New("(((1)))"), WithMaxDepth(5))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "1" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+
+	p = New(lexer.New("((((1))))"), WithMaxDepth(5))
+	p.ParseProgram()
+	errors = p.Errors()
+	if len(errors) != 1 || errors[0].Msg != "nesting is too deep, the limit is 5 levels" {
+		t.Errorf("wrong errors. got=%v", errors)
+	}
+	if errors[0].Start.Offset != 4 {
+		t.Errorf("wrong error position. expected=4, got=%d", errors[0].Start.Offset)
+	}
+
+	// Every call of the chain is a level
+	p = New(lexer.New("f()()()"), WithMaxDepth(5))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	p = New(lexer.New("f()()()()"), WithMaxDepth(5))
+	p.ParseProgram()
+	errors = p.Errors()
+	if len(errors) != 1 || errors[0].Code != ErrNestingTooDeep || errors[0].Start.Offset != 7 {
+		t.Errorf("wrong errors for a call chain. got=%v", errors)
+	}
+}
+
+// FuzzParseProgram feeds the parser random input. ParseProgram must not
+// panic or hang on any input, and neither must printing the program and
+// its errors. Every error must point into the input. New seeds go into
+// testdata/fuzz/FuzzParseProgram
+func FuzzParseProgram(f *testing.F) {
+	for _, seed := range []string{
+		"let x = 5; let add = fn(x, y) { x + y; }; add(x, 10)",
+		"-",
+		"1 +",
+		"if (x > 1) { return } else { y }",
+		"while (i < 10) { i += 1; if (i % 2 == 0) { continue } }",
+		"for (let i = 0; i < 3; i += 1) { break }",
+		"let a = [1, 2, 3][1:]; let h = {\"a\": 1, true: fn() {}};",
+		"a |> f -> g ** 2 ** -3 << 1 && !b || c",
+		"let x = (1 + ; foo(1 2) } ] ) { [",
+		"\"abc \\q 0b102 99999999999999999999 @ \xff",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		_ = program.String()
+
+		for _, err := range p.Errors() {
+			if !err.Start.IsValid() || err.Start.Offset > len(input) || err.End.Offset < err.Start.Offset {
+				t.Fatalf("error %q has a bad span %v-%v", err.Msg, err.Start, err.End)
+			}
+			_ = err.Error()
+		}
+	})
+}
+
+func checkParserErrors(t *testing.T, p *Parser) {
+	errors := p.Errors()
+	if len(errors) == 0 {
+		return
+	}
+
+	t.Errorf("parser has %d errors", len(errors))
+	for _, err := range errors {
+		t.Errorf("parser error: %s", err)
+	}
+
+	t.FailNow()
+}
+
+// testTree checks that got is the tree want. Positions aren't compared,
+// the trees written by hand in the tests have none
+func testTree(t *testing.T, got, want ast.Node) bool {
+	t.Helper()
+
+	if d := ast.Diff(got, want, ast.IgnorePositions()); d != "" {
+		t.Errorf("wrong tree (got != want) at %s", d)
+		return false
+	}
+	return true
+}
+
+// testSameTree checks that program is what expected parses into, which
+// is the same program written in another way
+func testSameTree(t *testing.T, program *ast.Program, expected string) bool {
+	t.Helper()
+
+	p := New(lexer.New(expected))
+	want := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return testTree(t, program, want)
+}
+
+// expression parses input, which is a single expression, into the tree
+// an expression in a test is compared to
+func expression(t *testing.T, input string) ast.Expression {
+	t.Helper()
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("%q is not a single expression. got=%d statements", input, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("%q is not an expression. got=%T", input, program.Statements[0])
+	}
+	return stmt.Expression
+}
+
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	input := corpus.Benchmark()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			b.Fatalf("parser has errors: %v", p.Errors()[0])
+		}
+	}
+}
+
+// The JSON of a parsed program reads back into the same tree, tokens,
+// positions, trivia and broken statements included
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 5; // five\nreturn x;",
+		"let add = fn(a, b) { a + b }; add(1, 2 * 3.5);",
+		"if (x < y) { x } else { /* smaller */ y }",
+		"while (true) { break; } for (let i = 0; i < 10; i += 1) { continue; }",
+		`{"one": [1, null][0], "two": a[1:], "\u00e9": !false}`,
+		"let = 5; let y = 0x; f(",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input, lexer.WithFilename("test.mk"), lexer.WithTrivia()))
+		program := p.ParseProgram()
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		var decoded ast.Program
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		if !reflect.DeepEqual(program, &decoded) {
+			t.Errorf("%q: the program changed.\n%s", input, data)
+		}
+	}
 }
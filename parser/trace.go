@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thewebdevel/monkey-interpreter/token"
+)
+
+// WithTrace makes the parser write down what it does to w, which helps to
+// find out why an expression was put together the way it was. Every parse
+// function that's entered gets a line, with the tokens the parser is on, and
+// the lines of the functions it calls are indented below it:
+//
+//	1:1: Statement cur=INT "1" peek=+
+//	1:1: . Expression LOWEST cur=INT "1" peek=+
+//	1:1: . . Prefix INT cur=INT "1" peek=+
+//	1:1: . . end Prefix
+//	1:1: . . peek + SUM > LOWEST, parse infix
+//	1:3: . . Infix + cur=+ peek=INT "2"
+//
+// The lines of parseExpression's loop show the precedences it compares.
+// Without WithTrace the parser doesn't do any of this work
+func WithTrace(w io.Writer) Option {
+	return func(p *Parser) {
+		p.traceOut = w
+	}
+}
+
+// precedenceNames gives the precedence constants a name in the trace
+var precedenceNames = [...]string{
+	LOWEST:      "LOWEST",
+	ASSIGN:      "ASSIGN",
+	ARROW:       "ARROW",
+	PIPE:        "PIPE",
+	OR:          "OR",
+	AND:         "AND",
+	EQUALS:      "EQUALS",
+	LESSGREATER: "LESSGREATER",
+	SHIFT:       "SHIFT",
+	SUM:         "SUM",
+	PRODUCT:     "PRODUCT",
+	PREFIX:      "PREFIX",
+	POWER:       "POWER",
+	CALL:        "CALL",
+	INDEX:       "INDEX",
+}
+
+func precedenceName(precedence int) string {
+	if 0 < precedence && precedence < len(precedenceNames) {
+		return precedenceNames[precedence]
+	}
+	return fmt.Sprint(precedence)
+}
+
+// trace writes the line for entering the parse function name and indents
+// the lines that follow. It returns name, so the matching untrace can be
+// deferred: defer p.untrace(p.trace("Block"))
+func (p *Parser) trace(name string) string {
+	p.printTrace("%s cur=%s peek=%s", name, traceToken(p.curToken), traceToken(p.peekToken))
+	p.traceDepth++
+	return name
+}
+
+// untrace ends what trace started
+func (p *Parser) untrace(name string) {
+	p.traceDepth--
+	p.printTrace("end %s", name)
+}
+
+// traceLoop writes down the decision of parseExpression's loop
+func (p *Parser) traceLoop(precedence int) {
+	switch {
+	case p.panicking:
+		p.printTrace("stop after an error")
+	case p.peekTokenIs(token.SEMICOLON):
+		p.printTrace("peek ; ends the expression")
+	case precedence < p.peekPrecedence():
+		p.printTrace("peek %s %s > %s, parse infix", p.peekToken.Type,
+			precedenceName(p.peekPrecedence()), precedenceName(precedence))
+	default:
+		p.printTrace("peek %s %s <= %s, done", p.peekToken.Type,
+			precedenceName(p.peekPrecedence()), precedenceName(precedence))
+	}
+}
+
+// printTrace writes a line to the trace, starting with the position of
+// curToken and the indentation
+func (p *Parser) printTrace(format string, args ...any) {
+	fmt.Fprintf(p.traceOut, "%6s: %s", p.curToken.Start, strings.Repeat(". ", p.traceDepth))
+	fmt.Fprintf(p.traceOut, format, args...)
+	fmt.Fprintln(p.traceOut)
+}
+
+// traceToken shows a token in the trace. Identifiers and literals show
+// their literal, for the other tokens the type says it all
+func traceToken(tok token.Token) string {
+	switch tok.Type {
+	case token.IDENT, token.INT, token.FLOAT, token.STRING, token.ILLEGAL:
+		return fmt.Sprintf("%s %q", tok.Type, tok.Literal)
+	}
+	return tok.Type.String()
+}
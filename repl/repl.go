@@ -9,15 +9,27 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/thewebdevel/monkey-interpreter/ast"
 	"github.com/thewebdevel/monkey-interpreter/lexer"
+	"github.com/thewebdevel/monkey-interpreter/parser"
 	"github.com/thewebdevel/monkey-interpreter/token"
 )
 
 // PROMPT to the user inside the console or REPL
 const PROMPT = ">> "
 
-// Start function reads the input and print out the tokens
+// dumps are the commands that print the syntax tree of the rest of the
+// line instead of its tokens, ex: :sexpr 1 + 2 * 3
+var dumps = map[string]func(ast.Node) string{
+	":ast":   func(node ast.Node) string { return node.String() + "\n" },
+	":sexpr": func(node ast.Node) string { return ast.SExpr(node) + "\n" },
+	":dot":   ast.Dot,
+}
+
+// Start function reads the input and print out the tokens. A line that
+// starts with one of the dumps prints its syntax tree instead
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
@@ -31,6 +43,12 @@ func Start(in io.Reader, out io.Writer) {
 
 		// Take the read line and pass it to an instance of our lexer
 		line := scanner.Text()
+		name, code, _ := strings.Cut(line, " ")
+		if dump, ok := dumps[name]; ok {
+			printTree(out, code, dump)
+			continue
+		}
+
 		l := lexer.New(line)
 		// Print all the token the lexer gives us until EOF
 		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
@@ -38,3 +56,16 @@ func Start(in io.Reader, out io.Writer) {
 		}
 	}
 }
+
+// printTree parses code and prints its tree with dump, or the parse errors
+func printTree(out io.Writer, code string, dump func(ast.Node) string) {
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Fprintf(out, "\t%s\n", err)
+		}
+		return
+	}
+	fmt.Fprint(out, dump(program))
+}
@@ -1,57 +1,379 @@
 package token
 
-// TokenType is  custom type of type string
-type TokenType string
+import (
+	"fmt"
+	"sync"
+)
+
+// TokenType is a small integer that tells what kind of token we have.
+// Comparing two of them is as cheap as comparing two numbers, and tables
+// indexed by TokenType can be plain arrays instead of maps
+type TokenType uint8
 
 // Token is a struct that has Type and Literal
+// Start and End tell us where the token was found in the source. Start points
+// to the first character of the token and End points just past the last one,
+// so the source text of a token is always input[Start.Offset:End.Offset]
+//
+// LeadingTrivia and TrailingTrivia are only filled in when the lexer is
+// asked to keep trivia, otherwise whitespace and comments are thrown away
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Start   Position  `json:"start"`
+	End     Position  `json:"end"`
+
+	LeadingTrivia  []Trivia `json:"leadingTrivia,omitempty"`
+	TrailingTrivia []Trivia `json:"trailingTrivia,omitempty"`
+}
+
+// TriviaKind tells what kind of source a Trivia holds
+type TriviaKind int
+
+// The different kinds of trivia
+const (
+	WHITESPACE    TriviaKind = iota // spaces, tabs and newlines
+	LINE_COMMENT                    // # comment or // comment
+	BLOCK_COMMENT                   // /* comment */
+)
+
+var triviaKinds = [...]string{
+	WHITESPACE:    "WHITESPACE",
+	LINE_COMMENT:  "LINE_COMMENT",
+	BLOCK_COMMENT: "BLOCK_COMMENT",
+}
+
+func (k TriviaKind) String() string {
+	if 0 <= k && int(k) < len(triviaKinds) {
+		return triviaKinds[k]
+	}
+
+	return fmt.Sprintf("TriviaKind(%d)", int(k))
+}
+
+// MarshalText encodes the kind as its name, ex: "LINE_COMMENT"
+func (k TriviaKind) MarshalText() ([]byte, error) {
+	if 0 <= k && int(k) < len(triviaKinds) {
+		return []byte(triviaKinds[k]), nil
+	}
+	return nil, fmt.Errorf("token: unknown trivia kind %d", int(k))
+}
+
+// UnmarshalText decodes the name of a kind
+func (k *TriviaKind) UnmarshalText(text []byte) error {
+	for kind, name := range triviaKinds {
+		if name == string(text) {
+			*k = TriviaKind(kind)
+			return nil
+		}
+	}
+	return fmt.Errorf("token: unknown trivia kind %q", text)
+}
+
+// Trivia is a piece of source that means nothing to the parser, like
+// whitespace or a comment. Text is the source text exactly as it was found,
+// including the comment markers, so the source can be put back together
+// from the tokens and their trivia.
+type Trivia struct {
+	Kind  TriviaKind `json:"kind"`
+	Text  string     `json:"text"`
+	Start Position   `json:"start"`
+	End   Position   `json:"end"`
+}
+
+// Position describes a location in the source code.
+// Offset is a byte index into the input starting at 0, Line and Column
+// start at 1 the way editors count them. Filename is optional and is
+// empty when the source has no name (ex: a line typed into the REPL)
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// IsValid reports whether the position was set by the lexer. The zero value
+// of Position is not a valid position
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String returns the position in the form file:line:column, or line:column
+// when there is no filename. An invalid position is rendered as "-"
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+
+	return s
 }
 
 // Different token types in the monkey programming language
-// We defined it as constants
+// We defined it as constants. The operators and delimiters are grouped
+// between operatorBeg and operatorEnd, their names are their literals
 const (
-	ILLEGAL = "ILLEGAL"
-	EOF     = "EOF"
+	ILLEGAL TokenType = iota
+	EOF
 
 	// Identifiers as Literals
-	IDENT = "INDENT" // add, foobar, x, y...
-	INT   = "INT"    // 12345
+	IDENT  // add, foobar, x, y...
+	INT    // 12345, 0x1F, 0o17, 0b101, 1_000
+	FLOAT  // 3.14, 1e10, 2.5E-3
+	STRING // "foo bar"
 
+	operatorBeg
 	// Operators
-	ASSIGN   = "="
-	PLUS     = "+"
-	MINUS    = "-"
-	BANG     = "!"
-	SLASH    = "/"
-	ASTERISK = "*"
+	ASSIGN   // =
+	PLUS     // +
+	MINUS    // -
+	BANG     // !
+	SLASH    // /
+	ASTERISK // *
+	PERCENT  // %
+	POWER    // **
+
+	AND   // &&
+	OR    // ||
+	SHL   // <<
+	SHR   // >>
+	ARROW // ->
+	PIPE  // |>
+
+	PLUS_ASSIGN     // +=
+	MINUS_ASSIGN    // -=
+	ASTERISK_ASSIGN // *=
+	SLASH_ASSIGN    // /=
+	PERCENT_ASSIGN  // %=
+
+	EQ     // ==
+	NOT_EQ // !=
+	LT     // <
+	GT     // >
+	LT_EQ  // <=
+	GT_EQ  // >=
 
 	// Delimiters
-	COMMA     = ","
-	SEMICOLON = ";"
+	COMMA     // ,
+	SEMICOLON // ;
+	COLON     // :
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   // (
+	RPAREN   // )
+	LBRACE   // {
+	RBRACE   // }
+	LBRACKET // [
+	RBRACKET // ]
+	operatorEnd
 
 	// Keywords
-	FUNCTION = "FUNCTION"
-	LET      = "LET"
-	RETURN   = "RETURN"
-
-	EQ     = "=="
-	NOT_EQ = "!="
-	LT     = "<"
-	GT     = ">"
+	FUNCTION
+	LET
+	RETURN
+	TRUE
+	FALSE
+	IF
+	ELSE
+	WHILE
+	FOR
+	BREAK
+	CONTINUE
+	NULL
+
+	// The token types made by Register come after the built in ones
+	customBeg
+)
+
+// NumTokenTypes is the number of values a TokenType can take. Tables indexed
+// by TokenType, like the precedences of the parser, can be arrays of this size
+const NumTokenTypes = 1 << 8
+
+// names holds the String() of every TokenType. For operators and delimiters
+// this is the literal itself
+var names = [NumTokenTypes]string{
+	ILLEGAL: "ILLEGAL",
+	EOF:     "EOF",
+
+	IDENT:  "IDENT",
+	INT:    "INT",
+	FLOAT:  "FLOAT",
+	STRING: "STRING",
+
+	ASSIGN:   "=",
+	PLUS:     "+",
+	MINUS:    "-",
+	BANG:     "!",
+	SLASH:    "/",
+	ASTERISK: "*",
+	PERCENT:  "%",
+	POWER:    "**",
+
+	AND:   "&&",
+	OR:    "||",
+	SHL:   "<<",
+	SHR:   ">>",
+	ARROW: "->",
+	PIPE:  "|>",
+
+	PLUS_ASSIGN:     "+=",
+	MINUS_ASSIGN:    "-=",
+	ASTERISK_ASSIGN: "*=",
+	SLASH_ASSIGN:    "/=",
+	PERCENT_ASSIGN:  "%=",
+
+	EQ:     "==",
+	NOT_EQ: "!=",
+	LT:     "<",
+	GT:     ">",
+	LT_EQ:  "<=",
+	GT_EQ:  ">=",
+
+	COMMA:     ",",
+	SEMICOLON: ";",
+	COLON:     ":",
+
+	LPAREN:   "(",
+	RPAREN:   ")",
+	LBRACE:   "{",
+	RBRACE:   "}",
+	LBRACKET: "[",
+	RBRACKET: "]",
+
+	FUNCTION: "FUNCTION",
+	LET:      "LET",
+	RETURN:   "RETURN",
+	TRUE:     "TRUE",
+	FALSE:    "FALSE",
+	IF:       "IF",
+	ELSE:     "ELSE",
+	WHILE:    "WHILE",
+	FOR:      "FOR",
+	BREAK:    "BREAK",
+	CONTINUE: "CONTINUE",
+	NULL:     "NULL",
+}
+
+// String returns the name of the token type, ex: "IDENT" or "+"
+func (t TokenType) String() string {
+	registerMu.RLock()
+	name := names[t]
+	registerMu.RUnlock()
+
+	if name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+// MarshalText encodes the type as its name, the same as String returns.
+// The numbers of the types are not stable, a new built in type or a type
+// registered in a different order moves them around, the names stay
+func (t TokenType) MarshalText() ([]byte, error) {
+	registerMu.RLock()
+	defer registerMu.RUnlock()
+
+	if names[t] == "" {
+		return nil, fmt.Errorf("token: unknown token type %d", int(t))
+	}
+	return []byte(names[t]), nil
+}
+
+// UnmarshalText decodes the name of a type. A type made by Register has to
+// be registered before its name can be decoded
+func (t *TokenType) UnmarshalText(text []byte) error {
+	registerMu.RLock()
+	defer registerMu.RUnlock()
+
+	for typ := 0; typ < numTypes; typ++ {
+		if names[typ] != "" && names[typ] == string(text) {
+			*t = TokenType(typ)
+			return nil
+		}
+	}
+	return fmt.Errorf("token: unknown token type %q", text)
+}
+
+// registerMu guards names and numTypes, Register writes them while the
+// other goroutines may be reading names
+var (
+	registerMu sync.RWMutex
+	numTypes   = int(customBeg)
 )
 
+// Register makes a new token type for a language that's built on top of
+// Monkey, like a DSL with a range operator (..) or an in keyword. The lexer
+// learns about it with lexer.WithOperator or lexer.WithKeyword and the
+// parser with its options.
+//
+// The name is what String returns for the type. By convention it's the
+// literal for an operator and the upper case word for a keyword, like the
+// built in types. Registering the same name again returns the same type.
+//
+// Register is meant to be called while the program starts up, before any
+// tokens are made. It panics when all token types are used up
+func Register(name string) TokenType {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	for t := int(customBeg); t < numTypes; t++ {
+		if names[t] == name {
+			return TokenType(t)
+		}
+	}
+
+	if numTypes == NumTokenTypes {
+		panic("token: too many token types registered")
+	}
+
+	t := TokenType(numTypes)
+	names[t] = name
+	numTypes++
+
+	return t
+}
+
+// operators maps the literal of every operator and delimiter to its token
+// type, it's filled in from names. The lexer scans them with LookupOperator.
+//
+// The lexer reads the longest operator it can find, one char at a time, and
+// only moves on while what it has read so far is still an operator. So every
+// operator longer than two chars needs its prefix without the last char
+// to be an operator as well, ex: "**=" would need "**"
+var operators = map[string]TokenType{}
+
+func init() {
+	for t := operatorBeg + 1; t < operatorEnd; t++ {
+		operators[names[t]] = t
+	}
+}
+
+// LookupOperator checks the operator table to see if the given literal is
+// an operator or a delimiter. If it is, it returns the TokenType and true
+func LookupOperator(literal string) (TokenType, bool) {
+	tok, ok := operators[literal]
+	return tok, ok
+}
+
 // Define keywords
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"null":     NULL,
 }
 
 // LookupIndent Checks the keyword table to see if the given identifier is a keyword
@@ -0,0 +1,99 @@
+package token
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// The lexer only grows an operator while it stays an operator, so an
+// operator like "..." could never be read if ".." wasn't one too
+func TestOperatorPrefixes(t *testing.T) {
+	for literal := range operators {
+		if len(literal) <= 2 {
+			continue
+		}
+
+		prefix := literal[:len(literal)-1]
+		if _, ok := LookupOperator(prefix); !ok {
+			t.Errorf("operator %q can't be scanned, %q is not an operator", literal, prefix)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rng := Register("..")
+	in := Register("IN")
+
+	if rng == in {
+		t.Fatalf("Register returned the same type for two names")
+	}
+	if rng <= NULL || in <= NULL {
+		t.Errorf("registered types collide with built in types. got=%d, %d", rng, in)
+	}
+	if rng.String() != ".." || in.String() != "IN" {
+		t.Errorf("wrong names. got=%q, %q", rng, in)
+	}
+	if again := Register(".."); again != rng {
+		t.Errorf("registering a name again made a new type. expected=%d, got=%d", rng, again)
+	}
+
+	// Registering doesn't make an operator, that's up to the lexer
+	if _, ok := LookupOperator(".."); ok {
+		t.Errorf("registered type is a built in operator")
+	}
+}
+
+func TestTokenTypeText(t *testing.T) {
+	tests := []TokenType{EOF, IDENT, PLUS, LBRACE, FUNCTION, NULL, Register("UNTIL")}
+
+	for _, tt := range tests {
+		text, err := tt.MarshalText()
+		if err != nil {
+			t.Fatalf("%s: %v", tt, err)
+		}
+		var decoded TokenType
+		if err := decoded.UnmarshalText(text); err != nil {
+			t.Fatalf("%s: %v", tt, err)
+		}
+		if decoded != tt {
+			t.Errorf("wrong type for %q. expected=%d, got=%d", text, tt, decoded)
+		}
+	}
+
+	var decoded TokenType
+	if err := decoded.UnmarshalText([]byte("NOPE")); err == nil {
+		t.Errorf("expected an error for an unknown name")
+	}
+	if _, err := operatorEnd.MarshalText(); err == nil {
+		t.Errorf("expected an error for a type without a name")
+	}
+}
+
+// Registering while other goroutines look up names must be safe, run with
+// -race to check
+func TestRegisterConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				Register(fmt.Sprintf("CONCURRENT_%d_%d", i, j))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				for typ := 0; typ < NumTokenTypes; typ++ {
+					_ = TokenType(typ).String()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if name := Register("CONCURRENT_0_0").String(); name != "CONCURRENT_0_0" {
+		t.Errorf("wrong name. got=%q", name)
+	}
+}